@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// hopHeaders are the hop-by-hop headers which are meaningful only for a single transport-level connection and must not
+// be forwarded by proxies (RFC 7230, section 6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection", // non-standard but still sent by some clients
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders removes the hop-by-hop headers and the headers listed in the Connection header from h
+func removeHopHeaders(h http.Header) {
+	for _, connectionValue := range h.Values("Connection") {
+		for _, name := range strings.Split(connectionValue, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// upstreamRequestHeader builds the headers of the requests sent to the upstreams from the client request. Hop-by-hop
+// headers are stripped and the forwarding headers are appended. Both upstreams must receive the same headers.
+func upstreamRequestHeader(req *http.Request) http.Header {
+	h := req.Header.Clone()
+	if h == nil {
+		h = http.Header{}
+	}
+	removeHopHeaders(h)
+
+	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		if prior := h.Values("X-Forwarded-For"); len(prior) > 0 {
+			clientIP = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		h.Set("X-Forwarded-For", clientIP)
+	}
+
+	if h.Get("X-Forwarded-Proto") == "" {
+		if req.TLS != nil {
+			h.Set("X-Forwarded-Proto", "https")
+		} else {
+			h.Set("X-Forwarded-Proto", "http")
+		}
+	}
+
+	if h.Get("X-Forwarded-Host") == "" && req.Host != "" {
+		h.Set("X-Forwarded-Host", req.Host)
+	}
+
+	h.Add("Via", via(req.ProtoMajor, req.ProtoMinor))
+
+	return h
+}
+
+// copyResponseHeader copies the end-to-end headers of an upstream response to the client response, preserving the
+// multi-value headers like Set-Cookie as separate header lines
+func copyResponseHeader(dst http.Header, res *http.Response) {
+	src := res.Header.Clone()
+	removeHopHeaders(src)
+
+	for key, values := range src {
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+
+	dst.Add("Via", via(res.ProtoMajor, res.ProtoMinor))
+}
+
+// via returns the Via header value of Proksi for the given protocol version
+func via(protoMajor, protoMinor int) string {
+	return fmt.Sprintf("%d.%d proksi", protoMajor, protoMinor)
+}
@@ -11,37 +11,43 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"reflect"
 	"strconv"
-	"strings"
 	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/tidwall/sjson"
 	"go.uber.org/zap"
 
+	"github.com/snapp-incubator/proksi/internal/admin"
+	"github.com/snapp-incubator/proksi/internal/capture"
 	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/fingerprint"
 	"github.com/snapp-incubator/proksi/internal/logging"
 	"github.com/snapp-incubator/proksi/internal/metrics"
+	"github.com/snapp-incubator/proksi/internal/pipeline"
 	"github.com/snapp-incubator/proksi/internal/storage"
+	"github.com/snapp-incubator/proksi/internal/upstream"
 )
 
 var (
-	mainServiceClient = &http.Client{}
-	testServiceClient = &http.Client{}
+	mainServiceClient *http.Client
+	testServiceClient *http.Client
 
-	strg storage.Storage
+	fingerprints = fingerprint.NewTracker(fingerprint.MaxFingerprints)
+	recorder     = &pipeline.Recorder{Fingerprints: fingerprints}
 )
 
 var (
 	help       bool   // Indicates whether to show the help or not
 	configPath string // Path of config file
+	validate   bool   // Indicates whether to only validate the config file
 )
 
 func init() {
 	flag.BoolVar(&help, "help", false, "Show help")
 	flag.StringVar(&configPath, "config", "", "The path of config file")
+	flag.BoolVar(&validate, "validate", false, "Report the errors and warnings of the config file without serving")
 
 	// Parse the terminal flags
 	flag.Parse()
@@ -54,6 +60,10 @@ func main() {
 		return
 	}
 
+	if validate {
+		os.Exit(lint(configPath))
+	}
+
 	c := config.LoadHTTP(configPath)
 
 	// Initialize logging with configured level
@@ -63,47 +73,39 @@ func main() {
 
 	logging.L.Info("Logger initialized", zap.String("log_level", c.LogLevel))
 
-	if c.Upstreams.Main.Address == "" {
-		logging.L.Fatal("Main upstream backend can not be empty.")
+	if err := pipeline.ValidateConfigs(config.ComputedConfigs()); err != nil {
+		logging.L.Fatal("Invalid route configs", zap.Error(err))
+	}
+
+	var err error
+	mainServiceClient, err = upstream.NewClient(c.Upstreams.Main)
+	if err != nil {
+		logging.L.Fatal("Error in creating the main upstream client", zap.Error(err))
 	}
 
-	if c.Upstreams.Test.Address == "" {
-		logging.L.Fatal("Test upstream backend can not be empty.")
+	testServiceClient, err = upstream.NewClient(c.Upstreams.Test)
+	if err != nil {
+		logging.L.Fatal("Error in creating the test upstream client", zap.Error(err))
 	}
 
-	if config.ComputedConfigs != nil {
-		fmt.Printf("computed configs: %+v\n", *config.ComputedConfigs)
+	if computed := config.ComputedConfigs(); computed != nil {
+		fmt.Printf("computed configs: %+v\n", computed)
 	}
 
 	// Initialize storage backend based on configuration
-	switch c.StorageType {
-	case "stdout":
-		strg = &storage.StdoutStorage{}
-		logging.L.Info("Using stdout storage backend")
-	case "elasticsearch":
-		elasticConfig := elasticsearch.Config{
-			Addresses:              c.Elasticsearch.Addresses,
-			Username:               c.Elasticsearch.Username,
-			Password:               c.Elasticsearch.Password,
-			CloudID:                c.Elasticsearch.CloudID,
-			APIKey:                 c.Elasticsearch.APIKey,
-			ServiceToken:           c.Elasticsearch.ServiceToken,
-			CertificateFingerprint: c.Elasticsearch.CertificateFingerprint,
-		}
-		es, err := elasticsearch.NewClient(elasticConfig)
-		if err != nil {
-			logging.L.Fatal("Error in connecting to Elasticsearch", zap.Error(err))
-		}
+	recorder.Storage, err = storage.New(c)
+	if err != nil {
+		logging.L.Fatal("Error in initializing the storage backend", zap.Error(err))
+	}
 
-		esInfo, err := es.Info()
+	// Initialize the traffic capture
+	var capturer *capture.Writer
+	if c.Capture.Enabled {
+		capturer, err = capture.NewWriter(c.Capture)
 		if err != nil {
-			logging.L.Fatal("Error in getting info from Elasticsearch", zap.Error(err))
+			logging.L.Fatal("Error in initializing the traffic capture", zap.Error(err))
 		}
-
-		logging.L.Info("Connected to Elasticsearch", zap.String("info", esInfo.String()))
-		strg = &storage.ElasticStorage{ES: es}
-	default:
-		logging.L.Fatal("Unknown storage type", zap.String("storage_type", c.StorageType))
+		logging.L.Info("Capturing traffic", zap.String("directory", c.Capture.Directory), zap.String("format", c.Capture.Format))
 	}
 
 	jobs := make(chan Job, c.Worker.QueueSize)
@@ -117,7 +119,7 @@ func main() {
 	}
 
 	mux := http.NewServeMux()
-	s := &server{job: jobs}
+	s := &server{job: jobs, capture: capturer}
 	mux.HandleFunc("/", s.handle)
 
 	srv := &http.Server{
@@ -137,11 +139,25 @@ func main() {
 	}()
 
 	if c.Metrics.Enabled {
-		go metrics.InitializeHTTP(c.Metrics.Bind)
+		go metrics.InitializeHTTP(c.Metrics.Bind, map[string]http.Handler{
+			"/fingerprints": http.HandlerFunc(serveFingerprints),
+		})
+	}
+
+	if c.Admin.Enabled {
+		go func() {
+			logging.L.Info("Starting admin server", zap.String("address", c.Admin.Bind), zap.Bool("persist", c.Admin.Persist))
+			if err := admin.New(c.Admin, configPath).ListenAndServe(c.Admin.Bind); err != http.ErrServerClosed {
+				logging.L.Fatal("Error in admin server ListenAndServe", zap.Error(err))
+			}
+		}()
 	}
 
+	// Reload the route configurations on changes of the config file and on SIGHUP
+	newReloader(configPath).start()
+
 	sigint := make(chan os.Signal, 1)
-	signal.Notify(sigint, os.Interrupt)
+	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 	<-sigint
 
 	logging.L.Debug("Closing HTTP connections")
@@ -149,32 +165,39 @@ func main() {
 		logging.L.Error("Error in shutting down the HTTP server", zap.Error(err))
 	}
 
+	if capturer != nil {
+		if err := capturer.Close(); err != nil {
+			logging.L.Error("Error in closing the capture file", zap.Error(err))
+		}
+	}
+
 	logging.L.Info("HTTP server is shut down")
 }
 
 type server struct {
-	job        chan Job
-	reqCounter uint64
+	job            chan Job
+	reqCounter     uint64
+	capture        *capture.Writer // nil when the traffic capture is disabled
+	captureCounter uint64
 }
 
 func (s *server) handle(writer http.ResponseWriter, req *http.Request) {
 	route := config.FormatRoute(req.Method, req.URL.Path)
 
+	// The route configurations of this request, which a reload does not change anymore
+	computed := config.ComputedConfigs()
+
 	// Check if route should be skipped entirely
-	if config.IsRouteSkipped(route) {
+	if computed.IsRouteSkipped(route) {
 		metrics.RouteSkipCounter.WithLabelValues("config").Inc()
 
 		// For skipped routes, just proxy to main upstream without testing
-		reqBodyBuffer := &bytes.Buffer{}
-		io.Copy(reqBodyBuffer, req.Body)
-
-		mainReq, err := http.NewRequestWithContext(req.Context(), req.Method, config.HTTP.Upstreams.Main.Address+req.URL.String(), bytes.NewReader(reqBodyBuffer.Bytes()))
+		mainReq, err := newStreamingRequest(req.Context(), config.HTTP.Upstreams.Main.Address, req, upstreamRequestHeader(req), req.Body)
 		if err != nil {
 			http.Error(writer, "Failed to create upstream request", http.StatusInternalServerError)
 			return
 		}
 
-		mainReq.Header = req.Header
 		t := prometheus.NewTimer(metrics.HTTPReqDuration.WithLabelValues("main_upstream"))
 		mainRes, err := mainServiceClient.Do(mainReq)
 		t.ObserveDuration()
@@ -184,17 +207,12 @@ func (s *server) handle(writer http.ResponseWriter, req *http.Request) {
 			http.Error(writer, "Failed to reach upstream", http.StatusBadGateway)
 			return
 		}
+		defer func() { _ = mainRes.Body.Close() }()
 
 		// Copy response
-		for headerKey, headerValue := range mainRes.Header {
-			if len(headerValue) == 1 {
-				writer.Header().Set(headerKey, headerValue[0])
-			} else {
-				writer.Header().Set(headerKey, "["+strings.Join(headerValue, ",")+"]")
-			}
-		}
+		copyResponseHeader(writer.Header(), mainRes)
 		writer.WriteHeader(mainRes.StatusCode)
-		io.Copy(writer, mainRes.Body)
+		_, _ = io.Copy(writer, mainRes.Body)
 
 		metrics.HTTPReqCounter.WithLabelValues(strconv.Itoa(mainRes.StatusCode), "main_upstream").Inc()
 		return
@@ -219,384 +237,268 @@ func (s *server) handle(writer http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	var reqBodyBuffer bytes.Buffer
-	_, err := io.Copy(&reqBodyBuffer, req.Body)
-	if err != nil {
-		logging.L.Error("error in reading the request body", loggingFieldsWithError(err)...)
-		return
+	// Get route-specific configuration
+	routeConfig := computed.GetRequestRouteConfig(route, req)
+
+	atomic.AddUint64(&s.reqCounter, 1)
+	inBucket := s.reqCounter%100 < routeConfig.TestProbability-1
+	if routeConfig.Paused {
+		// Shadowing is paused through the admin API
+		metrics.RouteSkipCounter.WithLabelValues("paused").Inc()
+		inBucket = false
 	}
+	inCapture := s.capture != nil && atomic.AddUint64(&s.captureCounter, 1)%100 < config.HTTP.Capture.Probability
 
-	reqBodyReader := bytes.NewReader(reqBodyBuffer.Bytes())
-	mainReq, err := http.NewRequestWithContext(req.Context(), req.Method, config.HTTP.Upstreams.Main.Address+req.URL.String(), reqBodyReader)
+	// The request body is streamed to the main upstream. A bounded copy is only kept when the request is going to be
+	// sent to the test upstream as well, or captured.
+	var reqBody io.Reader = req.Body
+	var reqBodyCapture *upstream.CaptureReader
+	if inBucket || inCapture {
+		reqBodyCapture = upstream.NewCaptureReader(req.Body, config.HTTP.MaxCaptureSize)
+		reqBody = reqBodyCapture
+	}
+
+	// Both upstreams receive the same headers
+	reqHeader := upstreamRequestHeader(req)
+
+	mainReq, err := newStreamingRequest(req.Context(), config.HTTP.Upstreams.Main.Address, req, reqHeader, reqBody)
 	if err != nil {
 		logging.L.Error("error in creating the request to the main service", loggingFieldsWithError(err)...)
 		return
 	}
 
-	mainReq.Header = req.Header
+	startedAt := time.Now()
 	t := prometheus.NewTimer(metrics.HTTPReqDuration.WithLabelValues("main_upstream"))
 	mainRes, err := mainServiceClient.Do(mainReq)
-	t.ObserveDuration()
+	mainDuration := t.ObserveDuration()
 	if err != nil {
 		metrics.HTTPReqCounter.WithLabelValues("client_error", "main_upstream").Inc()
 		logging.L.Error("error in doing the request to the main service", loggingFieldsWithError(err)...)
 		return
 	}
+	defer func() { _ = mainRes.Body.Close() }()
 
 	metrics.HTTPReqCounter.WithLabelValues(strconv.Itoa(mainRes.StatusCode), "main_upstream").Inc()
-	// TODO: Array in HTTP header values (issue #1)
-	for headerKey, headerValue := range mainRes.Header {
-		if len(headerValue) == 1 {
-			writer.Header().Set(headerKey, headerValue[0])
-		} else {
-			writer.Header().Set(headerKey, "["+strings.Join(headerValue, ",")+"]")
-		}
-	}
+	copyResponseHeader(writer.Header(), mainRes)
 
 	writer.WriteHeader(mainRes.StatusCode)
 
-	var mainResBodyBuffer bytes.Buffer
-	_, err = io.Copy(&mainResBodyBuffer, mainRes.Body)
-	if err != nil {
-		logging.L.Error("error in copying the main upstream response into the byte buffer", loggingFieldsWithError(err)...)
-		return
+	// Stream the main upstream response to the client, capturing what the body comparison and the traffic capture need
+	bodyComparison := routeConfig.BodyComparison()
+	var mainResBody io.Reader = mainRes.Body
+	var mainResBodyCapture *upstream.CaptureReader
+	switch {
+	case inCapture:
+		mainResBodyCapture = upstream.NewCaptureReader(mainRes.Body, config.HTTP.MaxCaptureSize)
+		if inBucket && bodyComparison == config.BodyCompareHash {
+			mainResBodyCapture.WithDigest()
+		}
+		mainResBody = mainResBodyCapture
+	case inBucket:
+		switch bodyComparison {
+		case config.BodyCompareIgnore, config.BodyCompareStatusOnly:
+			// The body is not needed at all
+		case config.BodyCompareLengthOnly, config.BodyCompareHash:
+			mainResBodyCapture = upstream.NewDigestReader(mainRes.Body)
+			mainResBody = mainResBodyCapture
+		default:
+			mainResBodyCapture = upstream.NewCaptureReader(mainRes.Body, config.HTTP.MaxCaptureSize)
+			mainResBody = mainResBodyCapture
+		}
 	}
 
-	mainResBodyReader := bytes.NewReader(mainResBodyBuffer.Bytes())
-	_, err = io.Copy(writer, mainResBodyReader)
+	_, err = io.Copy(writer, mainResBody)
 	if err != nil {
 		logging.L.Error("error in writing the response to the response writer", loggingFieldsWithError(err)...)
 		return
 	}
 
-	// Get route-specific configuration
-	routeConfig := config.GetRouteConfig(route)
-
-	atomic.AddUint64(&s.reqCounter, 1)
-	inBucket := s.reqCounter%100 < routeConfig.TestProbability-1
-	if inBucket {
-		s.job <- &upstreamTestJob{
-			req:                    req,
-			route:                  route,
-			routeConfig:            routeConfig,
-			reqBodyReader:          reqBodyReader,
-			reqBodyBuffer:          &reqBodyBuffer,
-			loggingFieldsWithError: loggingFieldsWithError,
-			loggingFields:          loggingFields,
-			mainRes:                mainRes,
-			mainResBodyReader:      mainResBodyReader,
+	if reqBodyCapture != nil {
+		// The main upstream may answer before reading the whole request body, which the transport keeps sending in
+		// its own goroutine until it closes the body
+		if mainReq.Body != http.NoBody {
+			select {
+			case <-reqBodyCapture.Done():
+			case <-req.Context().Done():
+			}
 		}
-	} else {
-		logging.L.Info("Sending request without test upstream", loggingFields(mainRes.StatusCode, mainRes.StatusCode)...)
-		metrics.HTTPReqCounter.WithLabelValues(strconv.Itoa(mainRes.StatusCode), "test_upstream").Inc()
+		_ = reqBodyCapture.Close()
 	}
-}
-
-type Job interface {
-	Do()
-}
 
-type upstreamTestJob struct {
-	req           *http.Request
-	route         string
-	routeConfig   config.ComputedRouteConfig
-	reqBodyReader *bytes.Reader
-	reqBodyBuffer *bytes.Buffer
-
-	loggingFieldsWithError func(err error) []zap.Field
-	loggingFields          func(mainStatusCode, testStatusCode int) []zap.Field
-
-	mainRes           *http.Response
-	mainResBodyReader *bytes.Reader
-}
-
-func (j *upstreamTestJob) Do() {
-	_, err := j.reqBodyReader.Seek(0, io.SeekStart)
-	if err != nil {
-		logging.L.Error("error in seeking the body reader to the first of the stream", j.loggingFieldsWithError(err)...)
-		return
+	if inCapture {
+		s.captureExchange(req, reqHeader, reqBodyCapture, mainRes, mainResBodyCapture, startedAt, mainDuration)
 	}
 
-	testReq, err := http.NewRequestWithContext(context.Background(), j.req.Method, config.HTTP.Upstreams.Test.Address+j.req.URL.String(), j.reqBodyReader)
-	if err != nil {
-		logging.L.Error("error in creating the request to the test service", j.loggingFieldsWithError(err)...)
+	if !inBucket {
+		logging.L.Info("Sending request without test upstream", loggingFields(mainRes.StatusCode, mainRes.StatusCode)...)
+		metrics.HTTPReqCounter.WithLabelValues(strconv.Itoa(mainRes.StatusCode), "test_upstream").Inc()
 		return
 	}
 
-	testReq.Header = j.req.Header
-	t := prometheus.NewTimer(metrics.HTTPReqDuration.WithLabelValues("test_upstream"))
-	testRes, err := testServiceClient.Do(testReq)
-	t.ObserveDuration()
-	if err != nil {
-		metrics.HTTPReqCounter.WithLabelValues("client_error", "test_upstream").Inc()
-		logging.L.Error("error in doing the request to the test service", j.loggingFieldsWithError(err)...)
+	reqBodyBytes, ok := reqBodyCapture.Captured()
+	if !ok && mainReq.Body != http.NoBody {
+		logging.L.Info("Request body is not captured completely, skipping the comparison", loggingFields(mainRes.StatusCode, mainRes.StatusCode)...)
+		metrics.CaptureLimitExceededCounter.WithLabelValues("request").Inc()
 		return
 	}
 
-	metrics.HTTPReqCounter.WithLabelValues(strconv.Itoa(testRes.StatusCode), "test_upstream").Inc()
+	job := &upstreamTestJob{
+		req:                    req,
+		route:                  route,
+		routeConfig:            routeConfig,
+		bodyComparison:         bodyComparison,
+		reqHeader:              reqHeader,
+		reqBody:                reqBodyBytes,
+		loggingFieldsWithError: loggingFieldsWithError,
+		loggingFields:          loggingFields,
+		main: pipeline.Response{
+			StatusCode: mainRes.StatusCode,
+			Header:     mainRes.Header,
+			Duration:   mainDuration,
+		},
+	}
+
+	if mainResBodyCapture != nil {
+		switch bodyComparison {
+		case config.BodyCompareIgnore, config.BodyCompareStatusOnly, config.BodyCompareLengthOnly, config.BodyCompareHash:
+			// Only the size and the digest are compared
+		default:
+			job.main.Body, ok = mainResBodyCapture.Captured()
+			if !ok {
+				logging.L.Info("Main upstream response body exceeds the capture size, skipping the comparison", loggingFields(mainRes.StatusCode, mainRes.StatusCode)...)
+				metrics.CaptureLimitExceededCounter.WithLabelValues("response").Inc()
+				return
+			}
+		}
 
-	_, err = j.mainResBodyReader.Seek(0, io.SeekStart)
-	if err != nil {
-		logging.L.Error("error in seeking to the beginning of the main service response", j.loggingFieldsWithError(err)...)
-		return
+		job.main.BodySize, job.main.BodyDigest, _ = mainResBodyCapture.Digest()
 	}
 
-	mainResBody, err := io.ReadAll(j.mainResBodyReader)
-	if err != nil {
-		logging.L.Error("error in reading the body request of main service", j.loggingFieldsWithError(err)...)
-		return
-	}
-	defer func() { _ = j.mainRes.Body.Close() }()
+	s.job <- job
+}
 
-	testResBody, err := io.ReadAll(testRes.Body)
-	if err != nil {
-		logging.L.Error("error in reading the body request of test service", j.loggingFieldsWithError(err)...)
+// captureExchange queues the request and the main upstream response to be written to the capture files. Requests
+// whose bodies exceed max_capture_size are not captured.
+func (s *server) captureExchange(req *http.Request, reqHeader http.Header, reqBodyCapture *upstream.CaptureReader,
+	mainRes *http.Response, mainResBodyCapture *upstream.CaptureReader, startedAt time.Time, mainDuration time.Duration) {
+	reqBody, ok := reqBodyCapture.Captured()
+	if !ok && req.ContentLength != 0 {
+		metrics.TrafficCaptureCounter.WithLabelValues("too_large").Inc()
 		return
 	}
-	defer func() { _ = testRes.Body.Close() }()
-
-	if testRes.StatusCode != j.mainRes.StatusCode {
-		logging.L.Warn("Different status code from services", j.loggingFields(j.mainRes.StatusCode, testRes.StatusCode)...)
-		metrics.ComparisonResults.WithLabelValues("status_diff").Inc()
 
-		// Track when main upstream returns 2xx but test upstream returns non-2xx
-		if isStatus2xx(j.mainRes.StatusCode) && !isStatus2xx(testRes.StatusCode) {
-			metrics.StatusCode2xxVsNon2xxCounter.Inc()
-		}
-
-		log := storage.Log{
-			URL:                    j.req.URL.String(),
-			Method:                 j.req.Method,
-			Route:                  j.route,
-			Headers:                j.req.Header,
-			MainUpstreamStatusCode: j.mainRes.StatusCode,
-			TestUpstreamStatusCode: testRes.StatusCode,
-			ComparisonType:         "status_diff",
-		}
-
-		if j.routeConfig.StoreReqBody {
-			reqBody := j.reqBodyBuffer.String()
-			log.RequestBody = &reqBody
-		}
-
-		err = strg.Store(log)
-		if err != nil {
-			logging.L.Error("Error in logging the request into Storage", j.loggingFieldsWithError(err)...)
-		}
+	mainResBody, ok := mainResBodyCapture.Captured()
+	if !ok {
+		metrics.TrafficCaptureCounter.WithLabelValues("too_large").Inc()
 		return
 	}
 
-	mainResContentType := j.mainRes.Header.Get("content-type")
-	if j.routeConfig.CompareHeaders {
-		differentHeaders := j.compareHeaders(j.mainRes.Header, testRes.Header)
-		if len(differentHeaders) > 0 {
-			logging.L.Warn("Different response headers from services", j.loggingFields(j.mainRes.StatusCode, testRes.StatusCode)...)
-			metrics.ComparisonResults.WithLabelValues("header_diff").Inc()
-
-			log := storage.Log{
-				URL:                    j.req.URL.String(),
-				Method:                 j.req.Method,
-				Route:                  j.route,
-				Headers:                j.req.Header,
-				MainUpstreamStatusCode: j.mainRes.StatusCode,
-				TestUpstreamStatusCode: testRes.StatusCode,
-				ComparisonType:         "header_diff",
-				DifferentHeaders:       differentHeaders,
-			}
-
-			if j.routeConfig.StoreReqBody {
-				reqBody := j.reqBodyBuffer.String()
-				log.RequestBody = &reqBody
-			}
-
-			if j.routeConfig.StoreRespBodies {
-				mainResBody, _ := io.ReadAll(j.mainResBodyReader)
-				testResBody, _ := io.ReadAll(testRes.Body)
-				mainResBodyStr := string(mainResBody)
-				testResBodyStr := string(testResBody)
-				log.MainUpstreamResponsePayload = &mainResBodyStr
-				log.TestUpstreamResponsePayload = &testResBodyStr
-			}
-
-			err = strg.Store(log)
-			if err != nil {
-				logging.L.Error("Error in logging the request into Storage", j.loggingFieldsWithError(err)...)
-			}
-			return
-		}
+	entry := capture.Entry{
+		StartedAt:      startedAt,
+		Method:         req.Method,
+		Host:           req.Host,
+		URL:            req.URL.String(),
+		RequestHeader:  reqHeader,
+		RequestBody:    reqBody,
+		StatusCode:     mainRes.StatusCode,
+		ResponseHeader: mainRes.Header,
+		ResponseBody:   mainResBody,
+		Duration:       mainDuration,
 	}
 
-	var comparator bodyEqualizerFunc
-	var responseSkipPath bool
-
-	switch strings.ToLower(mainResContentType) {
-	case "application/json", "application/ld+json":
-		responseSkipPath = true
-		comparator = JSONBytesEqual
-	// TODO: We didn't have time to implement it.
-	// case "application/xml", "application/xhtml+xml", "text/xml":
-	//	responseSkipPath = false
-	//	comparator = xmlBytesEqual
-	default:
-		responseSkipPath = false
-		comparator = dummyBytesEqual
-	}
-
-	equalBody, err := comparator(mainResBody, testResBody)
-	if err != nil {
-		logging.L.Error("error in response equality check", j.loggingFieldsWithError(err)...)
+	if !s.capture.Write(entry) {
+		metrics.TrafficCaptureCounter.WithLabelValues("dropped").Inc()
 		return
 	}
 
-	if !equalBody && responseSkipPath {
-		if testRes.StatusCode == j.mainRes.StatusCode {
-			srcBodyStr := string(mainResBody)
-			testBodyStr := string(testResBody)
-
-			for i := 0; i < len(j.routeConfig.SkipJSONPaths); i++ {
-				srcBodyStr, err = sjson.Set(srcBodyStr, j.routeConfig.SkipJSONPaths[i], "useless")
-				if err != nil {
-					panic(err)
-				}
-
-				testBodyStr, err = sjson.Set(testBodyStr, j.routeConfig.SkipJSONPaths[i], "useless")
-				if err != nil {
-					panic(err)
-				}
-			}
-
-			mainResBody = []byte(srcBodyStr)
-			testResBody = []byte(testBodyStr)
-
-			equalBody, err = JSONBytesEqual(mainResBody, testResBody)
-			if err != nil {
-				logging.L.Error("error in JSON equality check of body request", j.loggingFieldsWithError(err)...)
-				return
-			}
-		}
-	}
-
-	if equalBody {
-		logging.L.Info("Equal body response", j.loggingFields(j.mainRes.StatusCode, testRes.StatusCode)...)
-		metrics.ComparisonResults.WithLabelValues("identical").Inc()
-	} else {
-		logging.L.Warn("NOT equal body response", j.loggingFields(j.mainRes.StatusCode, testRes.StatusCode)...)
-		metrics.ComparisonResults.WithLabelValues("body_diff").Inc()
-
-		l := storage.Log{
-			URL:                    j.req.URL.String(),
-			Method:                 j.req.Method,
-			Route:                  j.route,
-			Headers:                j.req.Header,
-			MainUpstreamStatusCode: j.mainRes.StatusCode,
-			TestUpstreamStatusCode: testRes.StatusCode,
-			ComparisonType:         "body_diff",
-		}
-
-		if j.routeConfig.StoreReqBody {
-			reqBody := j.reqBodyBuffer.String()
-			l.RequestBody = &reqBody
-		}
-
-		if j.routeConfig.StoreRespBodies {
-			mainResBodyStr := string(mainResBody)
-			testResBodyStr := string(testResBody)
-			l.MainUpstreamResponsePayload = &mainResBodyStr
-			l.TestUpstreamResponsePayload = &testResBodyStr
-		}
-
-		err = strg.Store(l)
-		if err != nil {
-			logging.L.Error("Error in logging the request into Storage", j.loggingFieldsWithError(err)...)
-		}
-	}
+	metrics.TrafficCaptureCounter.WithLabelValues("captured").Inc()
 }
 
-type bodyEqualizerFunc func(a, b []byte) (bool, error)
-
-// JSONBytesEqual compares the JSON in two byte slices.
-func JSONBytesEqual(a, b []byte) (bool, error) {
-	var json1, json2 interface{}
-	if err := json.Unmarshal(a, &json1); err != nil {
-		return false, err
+// newStreamingRequest creates the request to the upstream which streams the given body instead of the buffered one
+func newStreamingRequest(ctx context.Context, address string, req *http.Request, header http.Header, body io.Reader) (*http.Request, error) {
+	upstreamReq, err := http.NewRequestWithContext(ctx, req.Method, address+req.URL.String(), body)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := json.Unmarshal(b, &json2); err != nil {
-		return false, err
+	upstreamReq.ContentLength = req.ContentLength
+	if req.ContentLength == 0 {
+		upstreamReq.Body = http.NoBody
 	}
 
-	return reflect.DeepEqual(json2, json1), nil
+	upstreamReq.Header = header
+	return upstreamReq, nil
 }
 
-// xmlBytesEqual compares the JSON in two byte slices.
-func xmlBytesEqual(a, b []byte) (bool, error) {
-	// TODO: Implement it in the future
-	return false, nil
+type Job interface {
+	Do()
 }
 
-func dummyBytesEqual(a, b []byte) (bool, error) {
-	return bytes.Equal(a, b), nil
-}
+type upstreamTestJob struct {
+	req            *http.Request
+	route          string
+	routeConfig    config.ComputedRouteConfig
+	bodyComparison string      // Effective body comparison mode of the route
+	reqHeader      http.Header // Headers sent to the upstreams
+	reqBody        []byte
 
-// compareHeaders compares two sets of HTTP headers and returns a list of headers that differ
-func (j *upstreamTestJob) compareHeaders(mainHeaders, testHeaders http.Header) []string {
-	var differentHeaders []string
-	skipHeadersMap := make(map[string]bool)
+	loggingFieldsWithError func(err error) []zap.Field
+	loggingFields          func(mainStatusCode, testStatusCode int) []zap.Field
 
-	// Build skip headers map
-	for _, header := range j.routeConfig.SkipHeaders {
-		skipHeadersMap[strings.ToLower(header)] = true
-	}
+	main pipeline.Response
+}
 
-	// Check all headers in main response
-	for key, mainValues := range mainHeaders {
-		keyLower := strings.ToLower(key)
-		if skipHeadersMap[keyLower] {
-			continue
-		}
+func (j *upstreamTestJob) Do() {
+	testReq, err := http.NewRequestWithContext(context.Background(), j.req.Method, config.HTTP.Upstreams.Test.Address+j.req.URL.String(), bytes.NewReader(j.reqBody))
+	if err != nil {
+		logging.L.Error("error in creating the request to the test service", j.loggingFieldsWithError(err)...)
+		return
+	}
 
-		testValues, exists := testHeaders[key]
-		if !exists {
-			differentHeaders = append(differentHeaders, key)
-			continue
-		}
+	testReq.Header = j.reqHeader
+	t := prometheus.NewTimer(metrics.HTTPReqDuration.WithLabelValues("test_upstream"))
+	testRes, err := testServiceClient.Do(testReq)
+	testDuration := t.ObserveDuration()
+	if err != nil {
+		metrics.HTTPReqCounter.WithLabelValues("client_error", "test_upstream").Inc()
+		logging.L.Error("error in doing the request to the test service", j.loggingFieldsWithError(err)...)
+		return
+	}
 
-		// Compare header values
-		if len(mainValues) != len(testValues) {
-			differentHeaders = append(differentHeaders, key)
-			continue
-		}
+	metrics.HTTPReqCounter.WithLabelValues(strconv.Itoa(testRes.StatusCode), "test_upstream").Inc()
 
-		// Compare each value
-		different := false
-		for i, mainValue := range mainValues {
-			if mainValue != testValues[i] {
-				different = true
-				break
-			}
-		}
+	defer func() { _ = testRes.Body.Close() }()
 
-		if different {
-			differentHeaders = append(differentHeaders, key)
-		}
+	test, ok, err := pipeline.ReadResponse(testRes, testDuration, j.bodyComparison, config.HTTP.MaxCaptureSize)
+	if err != nil {
+		logging.L.Error("error in reading the body request of test service", j.loggingFieldsWithError(err)...)
+		return
 	}
 
-	// Check for headers that exist in test but not in main
-	for key := range testHeaders {
-		keyLower := strings.ToLower(key)
-		if skipHeadersMap[keyLower] {
-			continue
-		}
+	if !ok {
+		logging.L.Info("Test upstream response body exceeds the capture size, skipping the comparison", j.loggingFields(j.main.StatusCode, testRes.StatusCode)...)
+		metrics.CaptureLimitExceededCounter.WithLabelValues("test_response").Inc()
+		return
+	}
 
-		if _, exists := mainHeaders[key]; !exists {
-			differentHeaders = append(differentHeaders, key)
-		}
+	c := &pipeline.Comparison{
+		Request:     j.req,
+		RequestBody: j.reqBody,
+		Route:       j.route,
+		RouteConfig: j.routeConfig,
+		Main:        j.main,
+		Test:        test,
 	}
 
-	return differentHeaders
+	if l := pipeline.Compare(c); l != nil {
+		recorder.Record(c, *l)
+	}
 }
 
-// isStatus2xx returns true if the status code is in the 2xx range (200-299)
-func isStatus2xx(statusCode int) bool {
-	return statusCode >= 200 && statusCode <= 299
+// serveFingerprints lists the difference fingerprints seen since the start of the process, most frequent first
+func serveFingerprints(writer http.ResponseWriter, _ *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(fingerprints.Snapshot()); err != nil {
+		logging.L.Error("Error in writing the fingerprints", zap.Error(err))
+	}
 }
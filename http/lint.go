@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/logging"
+	"github.com/snapp-incubator/proksi/internal/pipeline"
+)
+
+// lint writes the errors and warnings of the config file to stdout and returns the exit code, which is 1 when there
+// is any of them
+func lint(path string) int {
+	c, issues, err := config.LintHTTP(path)
+	if err != nil {
+		fmt.Printf("%s: %s\n", config.SeverityError, err)
+		return 1
+	}
+
+	if err = logging.InitializeLogger(c.LogLevel); err != nil {
+		issues = append(issues, config.Issue{Severity: config.SeverityError, Key: "log_level", Message: err.Error()})
+	}
+
+	// The route configurations are logged while they are computed
+	_ = logging.InitializeLogger("error")
+	issues = append(issues, pipeline.LintConfigs(c)...)
+
+	// Errors first
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Severity == config.SeverityError && issues[j].Severity != config.SeverityError
+	})
+
+	errors := 0
+	for _, issue := range issues {
+		if issue.Severity == config.SeverityError {
+			errors++
+		}
+		fmt.Println(issue)
+	}
+
+	if len(issues) == 0 {
+		fmt.Printf("%s: no issues\n", path)
+		return 0
+	}
+
+	fmt.Printf("%s: %d errors, %d warnings\n", path, errors, len(issues)-errors)
+	return 1
+}
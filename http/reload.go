@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/knadh/koanf/providers/file"
+	"go.uber.org/zap"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/logging"
+	"github.com/snapp-incubator/proksi/internal/metrics"
+	"github.com/snapp-incubator/proksi/internal/pipeline"
+)
+
+// Triggers of a reload
+const (
+	reloadTriggerFile   = "file"
+	reloadTriggerSignal = "signal"
+)
+
+const (
+	// reloadDelay is how long the changes of the config file settle before it is reloaded, as editors write it in
+	// several steps
+	reloadDelay = 100 * time.Millisecond
+
+	// rewatchInterval is how often watching is retried after the config file was removed or replaced
+	rewatchInterval = time.Second
+)
+
+// reloader reloads the route configurations, i.e. global_config, route_configs, skip_routes and the legacy fields,
+// when the config file changes or on SIGHUP. The other sections are only read at startup.
+type reloader struct {
+	path string
+
+	mu    sync.Mutex // Serializes the reloads
+	timer *time.Timer
+}
+
+func newReloader(path string) *reloader {
+	metrics.ConfigReloadTimestamp.SetToCurrentTime()
+
+	return &reloader{path: path}
+}
+
+// start watches the config file and SIGHUP in the background
+func (r *reloader) start() {
+	r.watch()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			r.reload(reloadTriggerSignal)
+		}
+	}()
+}
+
+// watch reloads the config file after it changes. Watching ends when the file is removed, e.g. when an editor
+// replaces it, so it is started again once the file is back.
+func (r *reloader) watch() {
+	var once sync.Once
+	err := file.Provider(r.path).Watch(func(_ interface{}, err error) {
+		if err == nil {
+			r.scheduleReload()
+			return
+		}
+
+		once.Do(func() {
+			logging.L.Debug("Watching the config file ended, watching it again", zap.String("path", r.path), zap.Error(err))
+			r.scheduleReload()
+			time.AfterFunc(rewatchInterval, r.watch)
+		})
+	})
+	if err != nil {
+		logging.L.Warn("Error in watching the config file, retrying", zap.String("path", r.path), zap.Error(err))
+		time.AfterFunc(rewatchInterval, r.watch)
+	}
+}
+
+// scheduleReload reloads the config file once its changes settle
+func (r *reloader) scheduleReload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.timer = time.AfterFunc(reloadDelay, func() { r.reload(reloadTriggerFile) })
+}
+
+// reload validates the config file and swaps the route configurations. The current ones are kept when it is invalid.
+func (r *reloader) reload(trigger string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := config.ParseHTTP(r.path)
+	if err != nil {
+		r.fail(trigger, err)
+		return
+	}
+
+	// The changes made through the admin API are applied on top of the config file
+	if err = config.Apply(c, pipeline.ValidateConfigs); err != nil {
+		r.fail(trigger, err)
+		return
+	}
+
+	// config.HTTP is the config loaded at startup, which the process keeps using for these sections until it restarts,
+	// so the warning is repeated on every reload until then
+	if sections := restartSections(config.HTTP, c); len(sections) > 0 {
+		logging.L.Warn("Sections of the config file differ from the ones loaded at startup and need a restart",
+			zap.Strings("sections", sections))
+	}
+
+	computed := config.ComputedConfigs()
+
+	metrics.ConfigReloadCounter.WithLabelValues(trigger, "success").Inc()
+	metrics.ConfigReloadTimestamp.SetToCurrentTime()
+	logging.L.Info("Reloaded the route configurations",
+		zap.String("trigger", trigger),
+		zap.Int("route_configs", len(computed.Routes)),
+		zap.Int("skip_routes", len(computed.SkipRoutes)),
+	)
+}
+
+func (r *reloader) fail(trigger string, err error) {
+	metrics.ConfigReloadCounter.WithLabelValues(trigger, "failure").Inc()
+	logging.L.Error("Error in reloading the config file, keeping the current route configurations",
+		zap.String("trigger", trigger), zap.String("path", r.path), zap.Error(err))
+}
+
+// restartSections returns the sections of the config which differ between the startup config and the next one but
+// are only read at startup
+func restartSections(startup, next *config.HTTPConfig) []string {
+	sections := []struct {
+		name  string
+		value func(c *config.HTTPConfig) interface{}
+	}{
+		{"bind", func(c *config.HTTPConfig) interface{} { return c.Bind }},
+		{"log_level", func(c *config.HTTPConfig) interface{} { return c.LogLevel }},
+		{"metrics", func(c *config.HTTPConfig) interface{} { return c.Metrics }},
+		{"storage_type", func(c *config.HTTPConfig) interface{} { return c.StorageType }},
+		{"elasticsearch", func(c *config.HTTPConfig) interface{} { return c.Elasticsearch }},
+		{"upstreams", func(c *config.HTTPConfig) interface{} { return c.Upstreams }},
+		{"worker", func(c *config.HTTPConfig) interface{} { return c.Worker }},
+		{"capture", func(c *config.HTTPConfig) interface{} { return c.Capture }},
+		{"max_capture_size", func(c *config.HTTPConfig) interface{} { return c.MaxCaptureSize }},
+		{"admin", func(c *config.HTTPConfig) interface{} { return c.Admin }},
+	}
+
+	var changed []string
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.value(startup), section.value(next)) {
+			changed = append(changed, section.name)
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,322 @@
+// Package admin serves the API which shows the route configurations and changes them at runtime
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/logging"
+	"github.com/snapp-incubator/proksi/internal/pipeline"
+)
+
+// Server serves the admin API. Its changes are kept with config.UpdateRuntime, so they survive reloads of the
+// config file but not restarts, unless they are persisted.
+type Server struct {
+	token      []byte
+	configPath string // Config file the route changes are written to, empty to keep them only at runtime
+}
+
+// New returns the admin server of the config. The route changes are written to the config file at configPath when
+// persisting is enabled.
+func New(c config.Admin, configPath string) *Server {
+	s := &Server{token: []byte(c.Token)}
+	if c.Persist {
+		s.configPath = configPath
+	}
+
+	return s
+}
+
+// ListenAndServe serves the admin API on bind
+func (s *Server) ListenAndServe(bind string) error {
+	srv := http.Server{
+		Addr:    bind,
+		Handler: s.Handler(),
+	}
+
+	return srv.ListenAndServe()
+}
+
+// Handler returns the handler of the admin API, which requires the token of the server
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/routes", s.serveRoutes)
+	mux.HandleFunc("/resolve", s.serveResolve)
+	mux.HandleFunc("/pause", func(w http.ResponseWriter, r *http.Request) { s.servePause(w, r, true) })
+	mux.HandleFunc("/resume", func(w http.ResponseWriter, r *http.Request) { s.servePause(w, r, false) })
+
+	return s.authenticate(mux)
+}
+
+// authenticate rejects the requests without the bearer token of the server
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, "Bearer ")), s.token) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routes is the response of GET /routes
+type routes struct {
+	Global     config.ComputedRouteConfig            `json:"global"`
+	Routes     map[string]config.ComputedRouteConfig `json:"routes"`
+	SkipRoutes []string                              `json:"skip_routes"`
+	Runtime    config.Runtime                        `json:"runtime"`
+}
+
+// route is the response of the changes of a route
+type route struct {
+	Pattern string                     `json:"pattern"`
+	Config  config.ComputedRouteConfig `json:"config"`
+	Patch   config.RoutePatch          `json:"patch"`
+}
+
+// resolution is the response of GET /resolve
+type resolution struct {
+	Route   string                     `json:"route"`
+	Skipped bool                       `json:"skipped"`
+	Pattern string                     `json:"pattern"`          // Empty when the global config applies
+	Params  map[string]string          `json:"params,omitempty"` // Named route parameters of the pattern
+	Config  config.ComputedRouteConfig `json:"config"`
+}
+
+// patchRequest is the body of PATCH /routes
+type patchRequest struct {
+	TestProbability *uint64   `json:"test_probability"`
+	SkipHeaders     *[]string `json:"skip_headers"`
+	SkipJSONPaths   *[]string `json:"skip_json_paths"`
+}
+
+// serveRoutes lists the route configurations on GET, patches a route on PATCH and removes the runtime changes of a
+// route on DELETE
+func (s *Server) serveRoutes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		computed := config.ComputedConfigs()
+		skipRoutes := make([]string, 0, len(computed.SkipRoutes))
+		for skipRoute := range computed.SkipRoutes {
+			skipRoutes = append(skipRoutes, skipRoute)
+		}
+		sort.Strings(skipRoutes)
+
+		writeJSON(w, http.StatusOK, routes{
+			Global:     computed.Global,
+			Routes:     computed.Routes,
+			SkipRoutes: skipRoutes,
+			Runtime:    config.CurrentRuntime(),
+		})
+	case http.MethodPatch:
+		s.patchRoute(w, r)
+	case http.MethodDelete:
+		s.resetRoute(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	}
+}
+
+// serveResolve returns the route configuration of the route parameter, e.g. "GET:/api/users/42?format=csv". The
+// match conditions of route configs are evaluated on the query of the route, the host parameter and the header
+// parameters, e.g. "X-Client: web".
+func (s *Server) serveResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	query := r.URL.Query()
+	requestRoute, rawQuery, _ := strings.Cut(query.Get("route"), "?")
+	method, path, ok := strings.Cut(requestRoute, ":")
+	if !ok || method == "" || !strings.HasPrefix(path, "/") {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid route %q: must be METHOD:/path", requestRoute))
+		return
+	}
+
+	req := &http.Request{
+		Method: method,
+		URL:    &url.URL{Path: path, RawQuery: rawQuery},
+		Host:   query.Get("host"),
+		Header: http.Header{},
+	}
+	for _, header := range query["header"] {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid header %q: must be Name: value", header))
+			return
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	computed := config.ComputedConfigs()
+	routeConfig := computed.GetRequestRouteConfig(requestRoute, req)
+	writeJSON(w, http.StatusOK, resolution{
+		Route:   requestRoute,
+		Skipped: computed.IsRouteSkipped(requestRoute),
+		Pattern: routeConfig.Pattern,
+		Params:  config.RouteParams(routeConfig.Pattern, requestRoute),
+		Config:  routeConfig,
+	})
+}
+
+// servePause pauses or resumes shadowing of the route parameter, or of every route without it
+func (s *Server) servePause(w http.ResponseWriter, r *http.Request, paused bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	pattern := r.URL.Query().Get("route")
+	if pattern == "" {
+		err := config.UpdateRuntime(func(rt *config.Runtime) error {
+			rt.Paused = paused
+			return nil
+		}, pipeline.ValidateConfigs)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		logging.L.Info("Changed shadowing of every route through the admin API", zap.Bool("paused", paused))
+		writeJSON(w, http.StatusOK, struct {
+			Paused bool `json:"paused"`
+		}{paused})
+		return
+	}
+
+	changed, status, err := updateRoute(pattern, func(patch *config.RoutePatch) {
+		patch.Paused = paused
+	})
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	logging.L.Info("Changed shadowing of a route through the admin API", zap.String("pattern", pattern), zap.Bool("paused", paused))
+	writeJSON(w, http.StatusOK, changed)
+}
+
+// patchRoute changes test_probability, skip_headers or skip_json_paths of a route and persists them when enabled
+func (s *Server) patchRoute(w http.ResponseWriter, r *http.Request) {
+	var req patchRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+		return
+	}
+
+	if req.TestProbability == nil && req.SkipHeaders == nil && req.SkipJSONPaths == nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid body: test_probability, skip_headers or skip_json_paths is required"))
+		return
+	}
+	if req.TestProbability != nil && (*req.TestProbability == 0 || *req.TestProbability > 100) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid test_probability %d: must be between 1 and 100, pause the route instead of 0", *req.TestProbability))
+		return
+	}
+
+	pattern := r.URL.Query().Get("route")
+	changed, status, err := updateRoute(pattern, func(patch *config.RoutePatch) {
+		if req.TestProbability != nil {
+			patch.TestProbability = req.TestProbability
+		}
+		if req.SkipHeaders != nil {
+			patch.SkipHeaders = req.SkipHeaders
+		}
+		if req.SkipJSONPaths != nil {
+			patch.SkipJSONPaths = req.SkipJSONPaths
+		}
+	})
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	fields := []zap.Field{zap.String("pattern", pattern), zap.Any("patch", req), zap.Bool("persist", s.configPath != "")}
+	if s.configPath != "" {
+		patch := config.RoutePatch{TestProbability: req.TestProbability, SkipHeaders: req.SkipHeaders, SkipJSONPaths: req.SkipJSONPaths}
+		if err = config.PersistRoutePatch(s.configPath, pattern, patch); err != nil {
+			logging.L.Error("Error in persisting a route change of the admin API", append(fields, zap.Error(err))...)
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("changed at runtime but not persisted: %w", err))
+			return
+		}
+	}
+
+	logging.L.Info("Changed a route through the admin API", fields...)
+	writeJSON(w, http.StatusOK, changed)
+}
+
+// resetRoute removes the runtime changes of a route, so that the config file applies again
+func (s *Server) resetRoute(w http.ResponseWriter, r *http.Request) {
+	pattern := r.URL.Query().Get("route")
+	changed, status, err := updateRoute(pattern, func(patch *config.RoutePatch) {
+		*patch = config.RoutePatch{}
+	})
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+
+	logging.L.Info("Removed the runtime changes of a route through the admin API", zap.String("pattern", pattern))
+	writeJSON(w, http.StatusOK, changed)
+}
+
+// updateRoute changes the runtime patch of the route config of pattern with update. It returns the changed route, or
+// the status code and the error when it failed.
+func updateRoute(pattern string, update func(patch *config.RoutePatch)) (route, int, error) {
+	if _, ok := config.ComputedConfigs().Routes[pattern]; !ok {
+		return route{}, http.StatusNotFound, fmt.Errorf("no route config of %q in route_configs, use /resolve to find the pattern of a route", pattern)
+	}
+
+	var patch config.RoutePatch
+	err := config.UpdateRuntime(func(rt *config.Runtime) error {
+		patch = rt.Routes[pattern]
+		update(&patch)
+		if patch.IsEmpty() {
+			delete(rt.Routes, pattern)
+		} else {
+			rt.Routes[pattern] = patch
+		}
+		return nil
+	}, pipeline.ValidateConfigs)
+	if err != nil {
+		return route{}, http.StatusInternalServerError, err
+	}
+
+	return route{
+		Pattern: pattern,
+		Config:  config.ComputedConfigs().Routes[pattern],
+		Patch:   patch,
+	}, http.StatusOK, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.L.Error("Error in writing the admin API response", zap.Error(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
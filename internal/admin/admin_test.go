@@ -0,0 +1,286 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+)
+
+const testToken = "secret"
+
+// newTestServer applies a config with route configs of "GET:/api/users/*", one of them for the requests of web
+// clients, and returns an admin server of it
+func newTestServer(t *testing.T, persist bool) (*Server, string) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+route_configs:
+  "GET:/api/users/*":
+    test_probability: 50
+    skip_headers: ["X-Request-Id"]
+  "GET:/api/users/*#web":
+    test_probability: 10
+    match:
+      host: {equals: "api.example.com"}
+      query: [{name: "format", present: true}]
+      headers: [{name: "X-Client", equals: "web"}]
+skip_routes: ["GET:/health"]
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write the config file: %v", err)
+	}
+
+	c, err := config.ParseHTTP(path)
+	if err != nil {
+		t.Fatalf("ParseHTTP() error = %v", err)
+	}
+
+	if err = config.Apply(c, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	// Remove the runtime changes of the previous tests
+	reset := func(r *config.Runtime) error {
+		*r = config.Runtime{}
+		return nil
+	}
+	if err = config.UpdateRuntime(reset, nil); err != nil {
+		t.Fatalf("UpdateRuntime() error = %v", err)
+	}
+
+	return New(config.Admin{Token: testToken, Persist: persist}, path), path
+}
+
+func serve(s *Server, method, target, token, body string) *httptest.ResponseRecorder {
+	authorization := ""
+	if token != "" {
+		authorization = "Bearer " + token
+	}
+
+	return serveAuthorized(s, method, target, authorization, body)
+}
+
+// serveAuthorized serves a request with the Authorization header value, which is not set when empty
+func serveAuthorized(s *Server, method, target, authorization, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	return w
+}
+
+func TestServer_authenticate(t *testing.T) {
+	s, _ := newTestServer(t, false)
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "Valid token", authorization: "Bearer " + testToken, wantStatus: http.StatusOK},
+		{name: "Invalid token", authorization: "Bearer guess", wantStatus: http.StatusUnauthorized},
+		{name: "Missing token", authorization: "", wantStatus: http.StatusUnauthorized},
+		{name: "Missing scheme", authorization: testToken, wantStatus: http.StatusUnauthorized},
+		{name: "Other scheme", authorization: "Basic " + testToken, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveAuthorized(s, http.MethodGet, "/routes", tt.authorization, ""); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestServer_serveResolve(t *testing.T) {
+	s, _ := newTestServer(t, false)
+
+	tests := []struct {
+		name        string
+		route       string
+		params      string
+		wantStatus  int
+		wantPattern string
+		wantSkipped bool
+	}{
+		{name: "Route config", route: "GET:/api/users/42", wantStatus: http.StatusOK, wantPattern: "GET:/api/users/*"},
+		{name: "Global config", route: "POST:/api/orders", wantStatus: http.StatusOK, wantPattern: ""},
+		{name: "Skipped route", route: "GET:/health", wantStatus: http.StatusOK, wantSkipped: true},
+		{
+			name:        "Match conditions",
+			route:       "GET:/api/users/42%3Fformat=csv",
+			params:      "&host=api.example.com:8080&header=X-Client:%20web",
+			wantStatus:  http.StatusOK,
+			wantPattern: "GET:/api/users/*#web",
+		},
+		{
+			name:        "Failed match conditions",
+			route:       "GET:/api/users/42%3Fformat=csv",
+			params:      "&host=api.example.com",
+			wantStatus:  http.StatusOK,
+			wantPattern: "GET:/api/users/*",
+		},
+		{name: "Invalid route", route: "/api/users", wantStatus: http.StatusBadRequest},
+		{name: "Invalid header", route: "GET:/api/users/42", params: "&header=X-Client", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, http.MethodGet, "/resolve?route="+tt.route+tt.params, testToken, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var got resolution
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("Failed to unmarshal the response: %v", err)
+			}
+			if got.Pattern != tt.wantPattern || got.Skipped != tt.wantSkipped {
+				t.Errorf("resolution = %+v, want pattern %q and skipped %v", got, tt.wantPattern, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestServer_servePause(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantGlobal bool
+		wantRoute  bool
+	}{
+		{name: "Every route", target: "/pause", wantStatus: http.StatusOK, wantGlobal: true, wantRoute: true},
+		{name: "Route config", target: "/pause?route=GET:/api/users/*", wantStatus: http.StatusOK, wantRoute: true},
+		{name: "Route not in route_configs", target: "/pause?route=GET:/api/orders", wantStatus: http.StatusNotFound},
+		{name: "Resume", target: "/resume?route=GET:/api/users/*", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, false)
+
+			if w := serve(s, http.MethodPost, tt.target, testToken, ""); w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			computed := config.ComputedConfigs()
+			if computed.Global.Paused != tt.wantGlobal {
+				t.Errorf("global paused = %v, want %v", computed.Global.Paused, tt.wantGlobal)
+			}
+			if paused := computed.Routes["GET:/api/users/*"].Paused; paused != tt.wantRoute {
+				t.Errorf("route paused = %v, want %v", paused, tt.wantRoute)
+			}
+		})
+	}
+}
+
+func TestServer_patchRoute(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		persist     bool
+		wantStatus  int
+		wantConfig  config.ComputedRouteConfig
+		wantPersist string
+	}{
+		{
+			name:       "Test probability",
+			target:     "/routes?route=GET:/api/users/*",
+			body:       `{"test_probability": 10}`,
+			wantStatus: http.StatusOK,
+			wantConfig: config.ComputedRouteConfig{TestProbability: 10, SkipHeaders: []string{"X-Request-Id"}},
+		},
+		{
+			name:       "Skipped headers and JSON paths",
+			target:     "/routes?route=GET:/api/users/*",
+			body:       `{"skip_headers": ["Date"], "skip_json_paths": ["meta.time"]}`,
+			wantStatus: http.StatusOK,
+			wantConfig: config.ComputedRouteConfig{TestProbability: 50, SkipHeaders: []string{"Date"}, SkipJSONPaths: []string{"meta.time"}},
+		},
+		{
+			name:        "Persisted",
+			target:      "/routes?route=GET:/api/users/*",
+			body:        `{"test_probability": 10}`,
+			persist:     true,
+			wantStatus:  http.StatusOK,
+			wantConfig:  config.ComputedRouteConfig{TestProbability: 10, SkipHeaders: []string{"X-Request-Id"}},
+			wantPersist: "test_probability: 10",
+		},
+		{
+			name:       "Invalid test probability",
+			target:     "/routes?route=GET:/api/users/*",
+			body:       `{"test_probability": 0}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Unknown field",
+			target:     "/routes?route=GET:/api/users/*",
+			body:       `{"compare_body": "disable"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Empty patch",
+			target:     "/routes?route=GET:/api/users/*",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Route not in route_configs",
+			target:     "/routes?route=GET:/api/orders",
+			body:       `{"test_probability": 10}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, path := newTestServer(t, tt.persist)
+
+			w := serve(s, http.MethodPatch, tt.target, testToken, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			got := config.ComputedConfigs().Routes["GET:/api/users/*"]
+			if got.TestProbability != tt.wantConfig.TestProbability ||
+				strings.Join(got.SkipHeaders, ",") != strings.Join(tt.wantConfig.SkipHeaders, ",") ||
+				strings.Join(got.SkipJSONPaths, ",") != strings.Join(tt.wantConfig.SkipJSONPaths, ",") {
+				t.Errorf("route config = %+v, want %+v", got, tt.wantConfig)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read the config file: %v", err)
+			}
+			if persisted := tt.wantPersist != "" && strings.Contains(string(data), tt.wantPersist); persisted != tt.persist {
+				t.Errorf("config file = %s, want persisted %v", data, tt.persist)
+			}
+
+			// Removing the runtime changes restores the config file, which is changed when persisted
+			if w = serve(s, http.MethodDelete, tt.target, testToken, ""); w.Code != http.StatusOK {
+				t.Fatalf("DELETE status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+			}
+			if got = config.ComputedConfigs().Routes["GET:/api/users/*"]; got.TestProbability != 50 {
+				t.Errorf("test probability after DELETE = %d, want 50", got.TestProbability)
+			}
+		})
+	}
+}
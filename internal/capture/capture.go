@@ -0,0 +1,115 @@
+// Package capture writes sampled requests and the responses of the main upstream to rotating files, and reads them back
+// for the replay. Files are either JSONL, one entry per line, or HAR 1.2.
+package capture
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+)
+
+// Entry is a captured request and the response of the main upstream to it
+type Entry struct {
+	StartedAt      time.Time
+	Method         string
+	Host           string // Host requested by the client, used for the match conditions of route configs and the absolute URLs of HAR files
+	URL            string // Path and query of the request, relative to the upstreams
+	RequestHeader  http.Header
+	RequestBody    []byte
+	StatusCode     int
+	ResponseHeader http.Header
+	ResponseBody   []byte
+	Duration       time.Duration // Time until the main upstream response headers
+}
+
+// Path returns the path of the request URL
+func (e Entry) Path() string {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return e.URL
+	}
+
+	return u.Path
+}
+
+// jsonlEntry is the JSONL form of an Entry
+type jsonlEntry struct {
+	StartedAt  time.Time    `json:"started_at"`
+	Method     string       `json:"method"`
+	Host       string       `json:"host,omitempty"`
+	URL        string       `json:"url"`
+	Request    jsonlMessage `json:"request"`
+	Response   jsonlMessage `json:"response"`
+	DurationMs float64      `json:"duration_ms"`
+}
+
+type jsonlMessage struct {
+	Status       int         `json:"status,omitempty"`
+	Headers      http.Header `json:"headers"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"` // "base64" when the body is not valid UTF-8
+}
+
+func newJSONLEntry(e Entry) jsonlEntry {
+	j := jsonlEntry{
+		StartedAt:  e.StartedAt,
+		Method:     e.Method,
+		Host:       e.Host,
+		URL:        e.URL,
+		Request:    jsonlMessage{Headers: e.RequestHeader},
+		Response:   jsonlMessage{Status: e.StatusCode, Headers: e.ResponseHeader},
+		DurationMs: float64(e.Duration) / float64(time.Millisecond),
+	}
+	j.Request.Body, j.Request.BodyEncoding = encodeBody(e.RequestBody)
+	j.Response.Body, j.Response.BodyEncoding = encodeBody(e.ResponseBody)
+
+	return j
+}
+
+func (j jsonlEntry) entry() (Entry, error) {
+	requestBody, err := decodeBody(j.Request.Body, j.Request.BodyEncoding)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	responseBody, err := decodeBody(j.Response.Body, j.Response.BodyEncoding)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return Entry{
+		StartedAt:      j.StartedAt,
+		Method:         j.Method,
+		Host:           j.Host,
+		URL:            j.URL,
+		RequestHeader:  j.Request.Headers,
+		RequestBody:    requestBody,
+		StatusCode:     j.Response.Status,
+		ResponseHeader: j.Response.Headers,
+		ResponseBody:   responseBody,
+		Duration:       time.Duration(j.DurationMs * float64(time.Millisecond)),
+	}, nil
+}
+
+// encodeBody returns the body as text, base64 encoded when it is not valid UTF-8
+func encodeBody(body []byte) (text, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeBody(text, encoding string) ([]byte, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+
+	return []byte(text), nil
+}
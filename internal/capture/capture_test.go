@@ -0,0 +1,230 @@
+package capture
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+)
+
+func testEntries() []Entry {
+	startedAt := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	return []Entry{
+		{
+			StartedAt:      startedAt,
+			Method:         http.MethodGet,
+			Host:           "api.example.com",
+			URL:            "/api/orders/42?expand=items&expand=user",
+			RequestHeader:  http.Header{"Authorization": {"Bearer token"}, "Accept": {"application/json"}},
+			StatusCode:     http.StatusOK,
+			ResponseHeader: http.Header{"Content-Type": {"application/json"}, "Set-Cookie": {"a=1", "b=2"}},
+			ResponseBody:   []byte(`{"id":42,"total":10}`),
+			Duration:       12500 * time.Microsecond,
+		},
+		{
+			StartedAt:      startedAt.Add(time.Second),
+			Method:         http.MethodPost,
+			Host:           "api.example.com",
+			URL:            "/api/files",
+			RequestHeader:  http.Header{"Content-Type": {"application/octet-stream"}},
+			RequestBody:    []byte{0x00, 0xff, 0xfe, 0x10},
+			StatusCode:     http.StatusCreated,
+			ResponseHeader: http.Header{"Content-Type": {"image/png"}},
+			ResponseBody:   []byte{0x89, 'P', 'N', 'G', 0xff},
+			Duration:       3 * time.Millisecond,
+		},
+	}
+}
+
+func writeEntries(t *testing.T, c config.Capture, entries []Entry) {
+	t.Helper()
+
+	w, err := NewWriter(c)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	for _, e := range entries {
+		if !w.Write(e) {
+			t.Fatalf("Write() dropped the entry of %s", e.URL)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
+
+func readEntries(t *testing.T, directory string) []Entry {
+	t.Helper()
+
+	files, err := Files([]string{directory})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		err = ReadFile(file, func(e Entry) error {
+			entries = append(entries, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", file, err)
+		}
+	}
+
+	return entries
+}
+
+func TestWriterAndReadFile(t *testing.T) {
+	for _, format := range []string{config.CaptureFormatJSONL, config.CaptureFormatHAR} {
+		t.Run(format, func(t *testing.T) {
+			c := config.Capture{
+				Directory:   t.TempDir(),
+				Format:      format,
+				MaxFileSize: 100 << 20,
+				QueueSize:   10,
+			}
+			writeEntries(t, c, testEntries())
+
+			got := readEntries(t, c.Directory)
+			if !reflect.DeepEqual(got, testEntries()) {
+				t.Errorf("read entries = %+v, want %+v", got, testEntries())
+			}
+		})
+	}
+}
+
+func TestWriterRotation(t *testing.T) {
+	c := config.Capture{
+		Directory:   t.TempDir(),
+		Format:      config.CaptureFormatJSONL,
+		MaxFileSize: 1, // Every entry exceeds it, so each one is written to its own file
+		MaxFiles:    2,
+		QueueSize:   10,
+	}
+
+	var entries []Entry
+	for i := 0; i < 4; i++ {
+		e := testEntries()[0]
+		e.URL = "/api/orders/" + string(rune('a'+i))
+		entries = append(entries, e)
+	}
+	writeEntries(t, c, entries)
+
+	files, err := Files([]string{c.Directory})
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+
+	got := readEntries(t, c.Directory)
+	if len(got) != 2 || got[0].URL != "/api/orders/c" || got[1].URL != "/api/orders/d" {
+		t.Errorf("read entries of the remaining files = %+v, want the last 2 entries", got)
+	}
+}
+
+func TestReadFileHAR(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Entry
+		wantErr bool
+	}{
+		{
+			name: "Entry of a browser",
+			content: `{"log":{"version":"1.2","creator":{"name":"browser"},"pages":[{"id":"page_1"}],"entries":[
+				{"startedDateTime":"2024-05-01T10:30:00Z","time":2,"request":{"method":"GET","url":"https://api.example.com/api/users?id=1",
+				"headers":[{"name":":authority","value":"api.example.com"},{"name":"accept","value":"*/*"}]},
+				"response":{"status":200,"headers":[{"name":"content-type","value":"text/plain"}],"content":{"size":2,"text":"ok"}}}]}}`,
+			want: []Entry{
+				{
+					StartedAt:      time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC),
+					Method:         http.MethodGet,
+					Host:           "api.example.com",
+					URL:            "/api/users?id=1",
+					RequestHeader:  http.Header{"Accept": {"*/*"}},
+					StatusCode:     http.StatusOK,
+					ResponseHeader: http.Header{"Content-Type": {"text/plain"}},
+					ResponseBody:   []byte("ok"),
+					Duration:       2 * time.Millisecond,
+				},
+			},
+		},
+		{
+			name: "Unclosed file",
+			content: harHeader + `{"startedDateTime":"2024-05-01T10:30:00Z","request":{"method":"GET","url":"/a"},"response":{"status":204}}` +
+				",\n" + `{"startedDateTime":"2024-05-01T10:30:01Z","request":{"method":"GET","url":"/b"},"resp`,
+			want: []Entry{
+				{
+					StartedAt:      time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC),
+					Method:         http.MethodGet,
+					URL:            "/a",
+					RequestHeader:  http.Header{},
+					StatusCode:     http.StatusNoContent,
+					ResponseHeader: http.Header{},
+				},
+			},
+		},
+		{
+			name:    "Invalid entry",
+			content: harHeader + `{"startedDateTime":"yesterday"}` + harFooter,
+			wantErr: true,
+		},
+		{
+			name:    "No entries",
+			content: `{"log":{"version":"1.2"}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "traffic.har")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []Entry
+			err := ReadFile(path, func(e Entry) error {
+				got = append(got, e)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadFile() entries = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFileJSONLInvalidLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traffic.jsonl")
+	content := `{"method":"GET","url":"/a","request":{},"response":{"status":200}}` + "\n" + "not json\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var got int
+	err := ReadFile(path, func(e Entry) error {
+		got++
+		return nil
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("ReadFile() error = %v, want an error of line 2", err)
+	}
+	if got != 1 {
+		t.Errorf("ReadFile() read %d entries before the error, want 1", got)
+	}
+}
@@ -0,0 +1,174 @@
+package capture
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/), only the fields Proksi writes and reads
+
+const harHeader = `{"log":{"version":"1.2","creator":{"name":"proksi","version":"1.0"},"entries":[` + "\n"
+const harFooter = "\n]}}\n"
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"` // Not part of HAR 1.2 for requests, "base64" for bodies which are not UTF-8
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func newHAREntry(e Entry) harEntry {
+	durationMs := float64(e.Duration) / float64(time.Millisecond)
+	h := harEntry{
+		StartedDateTime: e.StartedAt,
+		Time:            durationMs,
+		Request: harRequest{
+			Method:      e.Method,
+			URL:         "http://" + e.Host + e.URL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(e.RequestHeader),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(e.RequestBody),
+		},
+		Response: harResponse{
+			Status:      e.StatusCode,
+			StatusText:  http.StatusText(e.StatusCode),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(e.ResponseHeader),
+			Content: harContent{
+				Size:     len(e.ResponseBody),
+				MimeType: e.ResponseHeader.Get("Content-Type"),
+			},
+			HeadersSize: -1,
+			BodySize:    len(e.ResponseBody),
+		},
+		Timings: harTimings{Send: 0, Wait: durationMs, Receive: 0},
+	}
+
+	if u, err := url.Parse(e.URL); err == nil {
+		for name, values := range u.Query() {
+			for _, value := range values {
+				h.Request.QueryString = append(h.Request.QueryString, harNameValue{Name: name, Value: value})
+			}
+		}
+		sort.Slice(h.Request.QueryString, func(i, j int) bool { return h.Request.QueryString[i].Name < h.Request.QueryString[j].Name })
+	}
+
+	if len(e.RequestBody) > 0 {
+		h.Request.PostData = &harPostData{MimeType: e.RequestHeader.Get("Content-Type")}
+		h.Request.PostData.Text, h.Request.PostData.Encoding = encodeBody(e.RequestBody)
+	}
+	h.Response.Content.Text, h.Response.Content.Encoding = encodeBody(e.ResponseBody)
+
+	return h
+}
+
+func (h harEntry) entry() (Entry, error) {
+	e := Entry{
+		StartedAt:      h.StartedDateTime,
+		Method:         h.Request.Method,
+		URL:            h.Request.URL,
+		RequestHeader:  http.Header{},
+		StatusCode:     h.Response.Status,
+		ResponseHeader: http.Header{},
+		Duration:       time.Duration(h.Time * float64(time.Millisecond)),
+	}
+
+	// Entries of other tools have absolute URLs as well
+	if u, err := url.Parse(h.Request.URL); err == nil && u.IsAbs() {
+		e.Host = u.Host
+		e.URL = u.RequestURI()
+	}
+
+	for _, header := range h.Request.Headers {
+		// HTTP/2 pseudo-headers of browser captures, e.g. ":authority"
+		if strings.HasPrefix(header.Name, ":") {
+			continue
+		}
+		e.RequestHeader.Add(header.Name, header.Value)
+	}
+	for _, header := range h.Response.Headers {
+		e.ResponseHeader.Add(header.Name, header.Value)
+	}
+
+	var err error
+	if h.Request.PostData != nil {
+		if e.RequestBody, err = decodeBody(h.Request.PostData.Text, h.Request.PostData.Encoding); err != nil {
+			return Entry{}, err
+		}
+	}
+
+	if e.ResponseBody, err = decodeBody(h.Response.Content.Text, h.Response.Content.Encoding); err != nil {
+		return Entry{}, err
+	}
+
+	return e, nil
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			headers = append(headers, harNameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+
+	return headers
+}
@@ -0,0 +1,185 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Files returns the capture files of the paths, in which a directory stands for its capture files in the order they
+// were written
+func Files(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, filePrefix+"*"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	return files, nil
+}
+
+// ReadFile calls fn with every entry of a capture file, until fn returns an error. Files with the .har extension are
+// read as HAR, the others as JSONL. A HAR file which is still written or was not closed properly is read up to its
+// last complete entry.
+func ReadFile(path string, fn func(Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	if strings.EqualFold(filepath.Ext(path), ".har") {
+		return readHAR(file, fn)
+	}
+
+	return readJSONL(file, fn)
+}
+
+func readJSONL(r io.Reader, fn func(Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var j jsonlEntry
+		if err := json.Unmarshal(scanner.Bytes(), &j); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		e, err := j.entry()
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// readHAR streams the entries of log.entries, skipping the other members
+func readHAR(r io.Reader, fn func(Entry) error) error {
+	input := &countingReader{r: r}
+	decoder := json.NewDecoder(input)
+
+	if err := enterMember(decoder, "log"); err != nil {
+		return err
+	}
+	if err := enterMember(decoder, "entries"); err != nil {
+		return err
+	}
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+
+	for i := 0; decoder.More(); i++ {
+		var h harEntry
+		if err := decoder.Decode(&h); err != nil {
+			if input.truncated(err) {
+				// The file was not closed, e.g. it is the current file of a running capture
+				return nil
+			}
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+
+		e, err := h.entry()
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enterMember reads the beginning of an object until the value of the member name
+func enterMember(decoder *json.Decoder, name string) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		if token == name {
+			return nil
+		}
+
+		var skipped json.RawMessage
+		if err = decoder.Decode(&skipped); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("no %q member in the HAR file", name)
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("invalid HAR file: expected %q, got %v", delim, token)
+	}
+
+	return nil
+}
+
+// countingReader tells whether a decoding error is caused by the end of the input
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	eof bool
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err == io.EOF {
+		c.eof = true
+	}
+
+	return n, err
+}
+
+func (c *countingReader) truncated(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr) && c.eof && syntaxErr.Offset >= c.n
+}
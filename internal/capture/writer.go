@@ -0,0 +1,173 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/logging"
+)
+
+// filePrefix is the prefix of the capture file names, which are followed by the UTC time the file was started at
+const filePrefix = "capture-"
+
+// Writer writes the entries to rotating files in the background, so that capturing never blocks the requests
+type Writer struct {
+	config  config.Capture
+	entries chan Entry
+	done    chan struct{}
+
+	file    *os.File
+	size    int64
+	entered bool // Whether an entry was written to the current HAR file
+}
+
+// NewWriter creates the capture directory and starts writing the entries
+func NewWriter(c config.Capture) (*Writer, error) {
+	if err := os.MkdirAll(c.Directory, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create the capture directory: %w", err)
+	}
+
+	w := &Writer{
+		config:  c,
+		entries: make(chan Entry, c.QueueSize),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+
+	return w, nil
+}
+
+// Write queues the entry to be written. It returns false when the queue is full and the entry is dropped.
+func (w *Writer) Write(e Entry) bool {
+	select {
+	case w.entries <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close writes the queued entries and closes the current file. Write must not be called afterwards.
+func (w *Writer) Close() error {
+	close(w.entries)
+	<-w.done
+
+	return w.closeFile()
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	for e := range w.entries {
+		if err := w.write(e); err != nil {
+			logging.L.Error("Error in writing the captured request", zap.String("url", e.URL), zap.Error(err))
+		}
+	}
+}
+
+func (w *Writer) write(e Entry) error {
+	if w.file == nil {
+		if err := w.openFile(); err != nil {
+			return err
+		}
+	}
+
+	var b []byte
+	var err error
+	if w.config.Format == config.CaptureFormatHAR {
+		b, err = json.Marshal(newHAREntry(e))
+		if w.entered {
+			b = append([]byte(",\n"), b...)
+		}
+	} else {
+		b, err = json.Marshal(newJSONLEntry(e))
+		b = append(b, '\n')
+	}
+	if err != nil {
+		return err
+	}
+
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	w.entered = true
+	if err != nil {
+		return err
+	}
+
+	if w.size >= w.config.MaxFileSize {
+		return w.closeFile()
+	}
+
+	return nil
+}
+
+// openFile starts a new capture file and removes the oldest ones beyond max_files
+func (w *Writer) openFile() error {
+	name := filepath.Join(w.config.Directory, filePrefix+time.Now().UTC().Format("20060102T150405.000000000")+"."+w.config.Format)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to create the capture file: %w", err)
+	}
+
+	w.file = file
+	w.size = 0
+	w.entered = false
+
+	if w.config.Format == config.CaptureFormatHAR {
+		n, err := w.file.WriteString(harHeader)
+		w.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	logging.L.Info("Started a capture file", zap.String("file", name))
+
+	return w.removeOldFiles()
+}
+
+func (w *Writer) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+
+	var err error
+	if w.config.Format == config.CaptureFormatHAR {
+		_, err = w.file.WriteString(harFooter)
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+
+	return err
+}
+
+func (w *Writer) removeOldFiles() error {
+	if w.config.MaxFiles == 0 {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(w.config.Directory, filePrefix+"*."+w.config.Format))
+	if err != nil {
+		return err
+	}
+
+	// The names sort by the time the files were started at, so the current file is the last one
+	sort.Strings(files)
+	for len(files) > w.config.MaxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return fmt.Errorf("failed to remove an old capture file: %w", err)
+		}
+		files = files[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package comparator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+)
+
+var (
+	assertionEnvOnce sync.Once
+	assertionEnv     *cel.Env
+	assertionEnvErr  error
+
+	// assertionPrograms caches the compiled assertions by expression
+	assertionPrograms sync.Map
+)
+
+// newAssertionEnv declares the variables of the assertions: "request", "main" and "test". The responses have the
+// status, headers, body and duration_ms fields, the request has the method, path, url, headers and body fields.
+// Header names are lower-cased and multiple values are joined by ", ". JSON bodies are decoded, other bodies are
+// strings and bodies which are not captured are null.
+func newAssertionEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("main", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("test", cel.MapType(cel.StringType, cel.DynType)),
+		cel.CrossTypeNumericComparisons(true),
+		// len is an alias of size, e.g. len(test.body.items)
+		cel.Function("len", cel.Overload("len_dyn", []*cel.Type{cel.DynType}, cel.IntType,
+			cel.UnaryBinding(func(v ref.Val) ref.Val {
+				if s, ok := v.(traits.Sizer); ok {
+					return s.Size()
+				}
+				return types.NewErr("len: unsupported type %s", v.Type().TypeName())
+			}),
+		)),
+	)
+}
+
+// CheckAssertion compiles an assertion, which must be a boolean CEL expression
+func CheckAssertion(expression string) error {
+	_, err := assertionProgram(expression)
+	return err
+}
+
+func assertionProgram(expression string) (cel.Program, error) {
+	if program, ok := assertionPrograms.Load(expression); ok {
+		return program.(cel.Program), nil
+	}
+
+	assertionEnvOnce.Do(func() {
+		assertionEnv, assertionEnvErr = newAssertionEnv()
+	})
+	if assertionEnvErr != nil {
+		return nil, assertionEnvErr
+	}
+
+	ast, issues := assertionEnv.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("assertion must be a boolean expression, got %s", ast.OutputType())
+	}
+
+	program, err := assertionEnv.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	assertionPrograms.Store(expression, program)
+
+	return program, nil
+}
+
+// FailedAssertions evaluates the assertions of the route on the exchange and returns the failed ones. An assertion
+// which cannot be evaluated, e.g. because of a missing member, fails with the error appended to its text.
+func FailedAssertions(e *Exchange) []string {
+	if len(e.RouteConfig.Assertions) == 0 {
+		return nil
+	}
+
+	vars := map[string]interface{}{
+		"request": map[string]interface{}{
+			"method":  e.Request.Method,
+			"path":    e.Request.URL.Path,
+			"url":     e.Request.URL.String(),
+			"headers": assertionHeaders(e.Request.Header),
+			"body":    assertionBody(e.RequestBody),
+		},
+		"main": assertionResponse(e.Main),
+		"test": assertionResponse(e.Test),
+	}
+
+	var failed []string
+	for _, expression := range e.RouteConfig.Assertions {
+		program, err := assertionProgram(expression)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", expression, err))
+			continue
+		}
+
+		result, _, err := program.Eval(vars)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", expression, err))
+			continue
+		}
+
+		if ok, isBool := result.Value().(bool); !isBool {
+			failed = append(failed, fmt.Sprintf("%s: result is %s, not a bool", expression, result.Type().TypeName()))
+		} else if !ok {
+			failed = append(failed, expression)
+		}
+	}
+
+	return failed
+}
+
+func assertionResponse(r Response) map[string]interface{} {
+	return map[string]interface{}{
+		"status":      r.StatusCode,
+		"headers":     assertionHeaders(r.Header),
+		"body":        assertionBody(r.Body),
+		"duration_ms": float64(r.Duration.Microseconds()) / 1000,
+	}
+}
+
+func assertionHeaders(header map[string][]string) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+
+	return headers
+}
+
+func assertionBody(body []byte) interface{} {
+	if body == nil {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return string(body)
+	}
+
+	return value
+}
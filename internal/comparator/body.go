@@ -0,0 +1,372 @@
+package comparator
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/jsonpath"
+	"github.com/snapp-incubator/proksi/internal/storage"
+)
+
+// maxBodyDiffs is the maximum number of differences reported for a pair of bodies
+const maxBodyDiffs = 100
+
+// ExactBytesEqual compares the bodies byte by byte
+func ExactBytesEqual(main, test []byte, _ config.ComputedRouteConfig) (Result, error) {
+	return Result{Equal: bytes.Equal(main, test)}, nil
+}
+
+// JSONBodiesEqual compares the JSON bodies and reports their differences. The skip JSON paths of the route are
+// removed from both bodies and the JSON normalizers are applied before the comparison.
+func JSONBodiesEqual(main, test []byte, routeConfig config.ComputedRouteConfig) (Result, error) {
+	var mainValue, testValue interface{}
+	if err := json.Unmarshal(main, &mainValue); err != nil {
+		return Result{}, err
+	}
+
+	if err := json.Unmarshal(test, &testValue); err != nil {
+		return Result{}, err
+	}
+
+	n, err := newJSONNormalizer(routeConfig)
+	if err != nil {
+		return Result{}, err
+	}
+
+	mainValue, _ = n.normalize(nil, mainValue)
+	testValue, _ = n.normalize(nil, testValue)
+
+	d := newJSONDiffer(routeConfig.JSONRules)
+	d.diff(nil, mainValue, testValue)
+
+	return Result{Equal: len(d.diffs) == 0, Diff: d.diffs}, nil
+}
+
+// jsonDiffer collects the differences of two decoded JSON values
+type jsonDiffer struct {
+	rules     []config.JSONRule
+	rulePaths [][]jsonpath.Step
+	diffs     []storage.BodyDiff
+}
+
+func newJSONDiffer(rules []config.JSONRule) *jsonDiffer {
+	d := &jsonDiffer{rules: rules}
+	for _, rule := range rules {
+		d.rulePaths = append(d.rulePaths, jsonpath.ParsePattern(rule.Path))
+	}
+
+	return d
+}
+
+// diff collects the differences of the values at the path given by segments
+func (d *jsonDiffer) diff(segments []string, main, test interface{}) {
+	if len(d.diffs) >= maxBodyDiffs {
+		return
+	}
+
+	switch mainValue := main.(type) {
+	case map[string]interface{}:
+		testValue, ok := test.(map[string]interface{})
+		if !ok {
+			d.add(changedDiff(segments, main, test))
+			return
+		}
+
+		keys := make([]string, 0, len(mainValue)+len(testValue))
+		for key := range mainValue {
+			keys = append(keys, key)
+		}
+		for key := range testValue {
+			if _, exists := mainValue[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			mainChild, mainExists := mainValue[key]
+			testChild, testExists := testValue[key]
+			d.childDiff(jsonpath.Append(segments, key), mainChild, mainExists, testChild, testExists, true)
+		}
+	case []interface{}:
+		testValue, ok := test.([]interface{})
+		if !ok {
+			d.add(changedDiff(segments, main, test))
+			return
+		}
+
+		rule := d.ruleAt(segments)
+		if rule.ArrayKey != "" {
+			d.keyedArrayDiff(segments, mainValue, testValue, rule.ArrayKey)
+			return
+		}
+
+		if rule.UnorderedArrays {
+			d.unorderedArrayDiff(segments, mainValue, testValue, allIndexes(mainValue), allIndexes(testValue))
+			return
+		}
+
+		length := len(mainValue)
+		if len(testValue) > length {
+			length = len(testValue)
+		}
+
+		for i := 0; i < length; i++ {
+			var mainChild, testChild interface{}
+			if i < len(mainValue) {
+				mainChild = mainValue[i]
+			}
+			if i < len(testValue) {
+				testChild = testValue[i]
+			}
+			d.childDiff(jsonpath.Append(segments, strconv.Itoa(i)), mainChild, i < len(mainValue), testChild, i < len(testValue), false)
+		}
+	default:
+		if !d.scalarsEqual(segments, main, test) {
+			d.add(changedDiff(segments, main, test))
+		}
+	}
+}
+
+// keyedArrayDiff collects the differences of two arrays of objects whose elements are matched by the value of key.
+// Matched elements are reported at their index in the main array. Elements without the key or with a duplicated key
+// are compared as a multiset.
+func (d *jsonDiffer) keyedArrayDiff(segments []string, main, test []interface{}, key string) {
+	mainByKey, mainRest := indexByKey(main, key)
+	testByKey, testRest := indexByKey(test, key)
+
+	for _, elementKey := range keysByIndex(mainByKey) {
+		i := mainByKey[elementKey]
+		elementSegments := jsonpath.Append(segments, strconv.Itoa(i))
+
+		j, exists := testByKey[elementKey]
+		if !exists {
+			d.add(storage.BodyDiff{Path: jsonpath.Format(elementSegments), Kind: storage.BodyDiffRemoved, Main: encodeJSONValue(main[i])})
+			continue
+		}
+
+		delete(testByKey, elementKey)
+		d.diff(elementSegments, main[i], test[j])
+	}
+
+	for _, elementKey := range keysByIndex(testByKey) {
+		j := testByKey[elementKey]
+		d.add(storage.BodyDiff{Path: jsonpath.Format(jsonpath.Append(segments, strconv.Itoa(j))), Kind: storage.BodyDiffAdded, Test: encodeJSONValue(test[j])})
+	}
+
+	d.unorderedArrayDiff(segments, main, test, mainRest, testRest)
+}
+
+// unorderedArrayDiff collects the differences of the given elements of two arrays compared as multisets. Each main
+// element is matched with an equal test element, unmatched ones are reported as removed or added at their index.
+func (d *jsonDiffer) unorderedArrayDiff(segments []string, main, test []interface{}, mainIndexes, testIndexes []int) {
+	matched := make([]bool, len(testIndexes))
+
+	for _, i := range mainIndexes {
+		elementSegments := jsonpath.Append(segments, strconv.Itoa(i))
+
+		found := false
+		for k, j := range testIndexes {
+			if !matched[k] && d.equal(elementSegments, main[i], test[j]) {
+				matched[k] = true
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			d.add(storage.BodyDiff{Path: jsonpath.Format(elementSegments), Kind: storage.BodyDiffRemoved, Main: encodeJSONValue(main[i])})
+		}
+	}
+
+	for k, j := range testIndexes {
+		if !matched[k] {
+			d.add(storage.BodyDiff{Path: jsonpath.Format(jsonpath.Append(segments, strconv.Itoa(j))), Kind: storage.BodyDiffAdded, Test: encodeJSONValue(test[j])})
+		}
+	}
+}
+
+// equal checks whether two values are equal under the rules without collecting their differences
+func (d *jsonDiffer) equal(segments []string, main, test interface{}) bool {
+	sub := &jsonDiffer{rules: d.rules, rulePaths: d.rulePaths}
+	sub.diff(segments, main, test)
+
+	return len(sub.diffs) == 0
+}
+
+// indexByKey maps the JSON encoding of the key member of the object elements to their index. The indexes of the
+// elements without the key or with a duplicated key are returned separately.
+func indexByKey(elements []interface{}, key string) (map[string]int, []int) {
+	byKey := make(map[string]int)
+	duplicated := make(map[string]bool)
+	var rest []int
+
+	for i, element := range elements {
+		object, ok := element.(map[string]interface{})
+		if !ok {
+			rest = append(rest, i)
+			continue
+		}
+
+		value, ok := object[key]
+		if !ok {
+			rest = append(rest, i)
+			continue
+		}
+
+		encoded := encodeJSONValue(value)
+		if first, exists := byKey[encoded]; exists {
+			delete(byKey, encoded)
+			duplicated[encoded] = true
+			rest = append(rest, first)
+		}
+
+		if duplicated[encoded] {
+			rest = append(rest, i)
+			continue
+		}
+
+		byKey[encoded] = i
+	}
+
+	sort.Ints(rest)
+	return byKey, rest
+}
+
+// keysByIndex returns the keys ordered by their element index
+func keysByIndex(byKey map[string]int) []string {
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return byKey[keys[i]] < byKey[keys[j]] })
+
+	return keys
+}
+
+func allIndexes(elements []interface{}) []int {
+	indexes := make([]int, len(elements))
+	for i := range elements {
+		indexes[i] = i
+	}
+
+	return indexes
+}
+
+// childDiff collects the differences of an object member or an array element which may be missing on either side.
+// A null member, unlike a null array element which changes the length of the array, may equal a missing one.
+func (d *jsonDiffer) childDiff(segments []string, main interface{}, mainExists bool, test interface{}, testExists bool, member bool) {
+	if mainExists && testExists {
+		d.diff(segments, main, test)
+		return
+	}
+
+	if member && (main == nil && test == nil) && d.ruleAt(segments).NullEqualsMissing {
+		return
+	}
+
+	if !testExists {
+		d.add(storage.BodyDiff{Path: jsonpath.Format(segments), Kind: storage.BodyDiffRemoved, Main: encodeJSONValue(main)})
+	} else {
+		d.add(storage.BodyDiff{Path: jsonpath.Format(segments), Kind: storage.BodyDiffAdded, Test: encodeJSONValue(test)})
+	}
+}
+
+// scalarsEqual compares two JSON scalars under the rules applying to their path
+func (d *jsonDiffer) scalarsEqual(segments []string, main, test interface{}) bool {
+	if main == test {
+		return true
+	}
+
+	rule := d.ruleAt(segments)
+
+	mainNumber, mainIsNumber := jsonNumber(main, rule.CoerceStrings)
+	testNumber, testIsNumber := jsonNumber(test, rule.CoerceStrings)
+	if !mainIsNumber || !testIsNumber {
+		return false
+	}
+
+	// Without coercion, a string is only equal to the same string, which is already checked
+	if _, ok := main.(string); ok {
+		if _, ok := test.(string); ok {
+			return false
+		}
+	}
+
+	if mainNumber == testNumber {
+		return true
+	}
+
+	difference := math.Abs(mainNumber - testNumber)
+	if difference <= rule.FloatTolerance {
+		return true
+	}
+
+	return difference <= rule.FloatRelativeTolerance*math.Max(math.Abs(mainNumber), math.Abs(testNumber))
+}
+
+// ruleAt returns the combination of the rules applying to the path given by segments. The array rules only apply to
+// the array exactly at their path, the others to the descendants of their path as well.
+func (d *jsonDiffer) ruleAt(segments []string) config.JSONRule {
+	var effective config.JSONRule
+	for i, rule := range d.rules {
+		if !jsonpath.MatchPrefix(d.rulePaths[i], segments) {
+			continue
+		}
+
+		effective.FloatTolerance = math.Max(effective.FloatTolerance, rule.FloatTolerance)
+		effective.FloatRelativeTolerance = math.Max(effective.FloatRelativeTolerance, rule.FloatRelativeTolerance)
+		effective.CoerceStrings = effective.CoerceStrings || rule.CoerceStrings
+		effective.NullEqualsMissing = effective.NullEqualsMissing || rule.NullEqualsMissing
+		if !jsonpath.Match(d.rulePaths[i], segments) {
+			continue
+		}
+
+		effective.UnorderedArrays = effective.UnorderedArrays || rule.UnorderedArrays
+		if rule.ArrayKey != "" {
+			effective.ArrayKey = rule.ArrayKey
+		}
+	}
+
+	return effective
+}
+
+func (d *jsonDiffer) add(diff storage.BodyDiff) {
+	if len(d.diffs) < maxBodyDiffs {
+		d.diffs = append(d.diffs, diff)
+	}
+}
+
+// jsonNumber returns the numeric value of a decoded JSON number, or of a string holding a number when coerce is set
+func jsonNumber(v interface{}, coerce bool) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case string:
+		if !coerce {
+			return 0, false
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func changedDiff(segments []string, main, test interface{}) storage.BodyDiff {
+	return storage.BodyDiff{Path: jsonpath.Format(segments), Kind: storage.BodyDiffChanged, Main: encodeJSONValue(main), Test: encodeJSONValue(test)}
+}
+
+func encodeJSONValue(v interface{}) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(v)
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
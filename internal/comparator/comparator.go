@@ -0,0 +1,168 @@
+package comparator
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/storage"
+)
+
+// Comparator compares the responses of the main and test upstreams to a request. Custom comparators implement
+// domain-specific rules, e.g. prices being equal after currency rounding, and are selected by name with the
+// comparator option of route_configs.
+type Comparator interface {
+	Compare(e *Exchange) (Result, error)
+}
+
+// ComparatorFunc is an adapter to use an ordinary function as a Comparator
+type ComparatorFunc func(e *Exchange) (Result, error)
+
+// Compare calls f(e)
+func (f ComparatorFunc) Compare(e *Exchange) (Result, error) {
+	return f(e)
+}
+
+// BodyComparator compares the bodies of the main and test upstream responses of a route
+type BodyComparator func(main, test []byte, routeConfig config.ComputedRouteConfig) (Result, error)
+
+// Compare compares the bodies of the exchange
+func (c BodyComparator) Compare(e *Exchange) (Result, error) {
+	return c(e.Main.Body, e.Test.Body, e.RouteConfig)
+}
+
+// Exchange holds a request, the responses of both upstreams to it and the config of its route
+type Exchange struct {
+	Request     *http.Request // The incoming request, its body is already consumed
+	RequestBody []byte
+	Route       string // Formatted route (METHOD:/path)
+	RouteConfig config.ComputedRouteConfig
+	Main        Response
+	Test        Response
+}
+
+// Response is the response of an upstream
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Duration   time.Duration // Time until the response headers
+}
+
+// Result is the verdict of a Comparator
+type Result struct {
+	Equal bool
+	Type  string             // Comparison type reported when not equal, "body_diff" when empty
+	Diff  []storage.BodyDiff // Structured differences, only reported by the comparators supporting them
+}
+
+// Names of the built-in body comparators
+const (
+	Exact = "exact"
+	JSON  = "json"
+	XML   = "xml"
+)
+
+var (
+	mu sync.RWMutex
+
+	// comparators holds the registered comparators by name
+	comparators = make(map[string]Comparator)
+
+	// mediaTypes maps media types ("application/json") and structured syntax suffixes ("+json") to comparator names
+	mediaTypes = make(map[string]string)
+)
+
+func init() {
+	Register(Exact, BodyComparator(ExactBytesEqual))
+	Register(JSON, BodyComparator(JSONBodiesEqual), "application/json", "+json")
+	Register(XML, BodyComparator(XMLBodiesEqual), "application/xml", "text/xml", "+xml")
+}
+
+// Register registers a comparator by name and makes it the comparator of the given media types. A media type starting
+// with "+" is a structured syntax suffix and matches every media type with that suffix, e.g. "+json" matches
+// "application/problem+json". Registering an existing name or media type replaces it. Comparators have to be
+// registered before the config is loaded, e.g. in an init function.
+func Register(name string, c Comparator, types ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	comparators[name] = c
+	for _, mediaType := range types {
+		mediaTypes[strings.ToLower(mediaType)] = name
+	}
+}
+
+// Get returns the comparator registered by name
+func Get(name string) (Comparator, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	c, ok := comparators[name]
+	return c, ok
+}
+
+// ForContentType returns the name and the comparator registered for the media type of a Content-Type header value.
+// An exact media type registration takes precedence over a suffix one. The exact comparator is returned when nothing
+// is registered for the media type.
+func ForContentType(contentType string) (string, Comparator) {
+	mediaType := MediaType(contentType)
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	name, ok := mediaTypes[mediaType]
+	if !ok {
+		if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+			name, ok = mediaTypes[mediaType[i:]]
+		}
+	}
+
+	if !ok {
+		name = Exact
+	}
+
+	return name, comparators[name]
+}
+
+// Select returns the name and the comparator of a response. The comparator forced by the route config takes
+// precedence over the one registered for the content type.
+func Select(routeConfig config.ComputedRouteConfig, contentType string) (string, Comparator, error) {
+	var c Comparator
+
+	name := routeConfig.Comparator
+	switch routeConfig.BodyComparison() {
+	case config.BodyCompareExact:
+		name = Exact
+	case config.BodyCompareJSON:
+		name = JSON
+	}
+
+	if name == "" {
+		name, c = ForContentType(contentType)
+		return name, c, nil
+	}
+
+	c, ok := Get(name)
+	if !ok {
+		return name, nil, fmt.Errorf("unknown comparator: %s", name)
+	}
+
+	return name, c, nil
+}
+
+// MediaType returns the lower-cased media type of a Content-Type header value without its parameters, e.g.
+// "application/json" for "Application/JSON; charset=utf-8". Malformed values are returned trimmed and lower-cased up
+// to the first ";".
+func MediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	}
+
+	return strings.ToLower(mediaType)
+}
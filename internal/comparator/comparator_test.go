@@ -0,0 +1,729 @@
+package comparator
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/storage"
+)
+
+func TestMediaType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		expected    string
+	}{
+		{"Plain media type", "application/json", "application/json"},
+		{"With charset parameter", "application/json; charset=utf-8", "application/json"},
+		{"Upper case", "Application/JSON; Charset=UTF-8", "application/json"},
+		{"Malformed parameters", "text/xml; charset", "text/xml"},
+		{"Empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MediaType(tt.contentType); got != tt.expected {
+				t.Errorf("MediaType(%q) = %q, want %q", tt.contentType, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestForContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		expected    string
+	}{
+		{"JSON", "application/json", JSON},
+		{"JSON with charset", "application/json; charset=utf-8", JSON},
+		{"JSON-LD suffix", "application/ld+json", JSON},
+		{"Problem details suffix", "application/problem+json; charset=utf-8", JSON},
+		{"XML", "text/xml; charset=utf-8", XML},
+		{"XHTML suffix", "application/xhtml+xml", XML},
+		{"Plain text falls back to exact", "text/plain", Exact},
+		{"Missing content type falls back to exact", "", Exact},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := ForContentType(tt.contentType); got != tt.expected {
+				t.Errorf("ForContentType(%q) = %q, want %q", tt.contentType, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name        string
+		routeConfig config.ComputedRouteConfig
+		contentType string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:        "By content type",
+			routeConfig: config.ComputedRouteConfig{CompareBody: true, BodyCompareMode: config.BodyCompareAuto},
+			contentType: "application/json",
+			expected:    JSON,
+		},
+		{
+			name:        "Forced by route comparator",
+			routeConfig: config.ComputedRouteConfig{CompareBody: true, BodyCompareMode: config.BodyCompareAuto, Comparator: JSON},
+			contentType: "text/plain",
+			expected:    JSON,
+		},
+		{
+			name:        "Forced by body compare mode",
+			routeConfig: config.ComputedRouteConfig{CompareBody: true, BodyCompareMode: config.BodyCompareExact},
+			contentType: "application/json",
+			expected:    Exact,
+		},
+		{
+			name:        "Unknown comparator",
+			routeConfig: config.ComputedRouteConfig{CompareBody: true, BodyCompareMode: config.BodyCompareAuto, Comparator: "unknown"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := Select(tt.routeConfig, tt.contentType)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Select() error = %v, expectError %v", err, tt.expectError)
+			}
+			if !tt.expectError && got != tt.expected {
+				t.Errorf("Select() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	// Prices are equal after rounding to cents, and a 200 answered with 201 is fine
+	Register("test_prices", ComparatorFunc(func(e *Exchange) (Result, error) {
+		if e.Main.StatusCode/100 != e.Test.StatusCode/100 {
+			return Result{Type: "status_class_diff"}, nil
+		}
+
+		return Result{Equal: bytes.EqualFold(e.Main.Body, e.Test.Body)}, nil
+	}), "application/x-test-prices")
+	defer func() {
+		mu.Lock()
+		delete(comparators, "test_prices")
+		delete(mediaTypes, "application/x-test-prices")
+		mu.Unlock()
+	}()
+
+	if name, _ := ForContentType("application/x-test-prices"); name != "test_prices" {
+		t.Errorf("ForContentType() = %q, want %q", name, "test_prices")
+	}
+
+	routeConfig := config.ComputedRouteConfig{CompareBody: true, BodyCompareMode: config.BodyCompareAuto, Comparator: "test_prices"}
+	name, c, err := Select(routeConfig, "application/json")
+	if err != nil || name != "test_prices" {
+		t.Fatalf("Select() = %q, %v, want %q", name, err, "test_prices")
+	}
+
+	got, err := c.Compare(&Exchange{
+		RouteConfig: routeConfig,
+		Main:        Response{StatusCode: 200, Body: []byte("USD")},
+		Test:        Response{StatusCode: 201, Body: []byte("usd")},
+	})
+	if err != nil || !got.Equal {
+		t.Errorf("Compare() = %+v, %v, want equal", got, err)
+	}
+
+	got, _ = c.Compare(&Exchange{
+		RouteConfig: routeConfig,
+		Main:        Response{StatusCode: 200},
+		Test:        Response{StatusCode: 500},
+	})
+	if got.Equal || got.Type != "status_class_diff" {
+		t.Errorf("Compare() = %+v, want a status_class_diff", got)
+	}
+}
+
+func TestBodyComparator_Compare(t *testing.T) {
+	c, _ := Get(JSON)
+	got, err := c.Compare(&Exchange{
+		Main: Response{Body: []byte(`{"a":1}`)},
+		Test: Response{Body: []byte(`{"a":2}`)},
+	})
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+
+	expected := Result{Diff: []storage.BodyDiff{{Path: "a", Kind: storage.BodyDiffChanged, Main: "1", Test: "2"}}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Compare() = %+v, want %+v", got, expected)
+	}
+}
+
+func TestXMLBodiesEqual(t *testing.T) {
+	tests := []struct {
+		name         string
+		main         string
+		test         string
+		skipXMLPaths []string
+		expected     bool
+		expectError  bool
+	}{
+		{
+			name:     "Whitespace and indentation",
+			main:     `<a><b>1</b><c>2</c></a>`,
+			test:     "<?xml version=\"1.0\"?>\n<a>\n  <b> 1 </b>\n  <c>2</c>\n</a>\n",
+			expected: true,
+		},
+		{
+			name:     "Attribute order",
+			main:     `<a x="1" y="2"/>`,
+			test:     `<a y="2" x="1"></a>`,
+			expected: true,
+		},
+		{
+			name:     "Namespace prefixes",
+			main:     `<soap:Envelope xmlns:soap="urn:env"><soap:Body>ok</soap:Body></soap:Envelope>`,
+			test:     `<s:Envelope xmlns:s="urn:env"><s:Body>ok</s:Body></s:Envelope>`,
+			expected: true,
+		},
+		{
+			name:     "Different namespaces",
+			main:     `<a:x xmlns:a="urn:one"/>`,
+			test:     `<a:x xmlns:a="urn:two"/>`,
+			expected: false,
+		},
+		{
+			name:     "Different text",
+			main:     `<a><b>1</b></a>`,
+			test:     `<a><b>2</b></a>`,
+			expected: false,
+		},
+		{
+			name:     "Different element order",
+			main:     `<a><b/><c/></a>`,
+			test:     `<a><c/><b/></a>`,
+			expected: false,
+		},
+		{
+			name:         "Skip anchored element path",
+			main:         `<a><ts>1</ts><b>1</b></a>`,
+			test:         `<a><ts>2</ts><b>1</b></a>`,
+			skipXMLPaths: []string{"/a/ts"},
+			expected:     true,
+		},
+		{
+			name:         "Skip element at any depth",
+			main:         `<a><b><ts>1</ts></b><ts>1</ts></a>`,
+			test:         `<a><b><ts>2</ts></b></a>`,
+			skipXMLPaths: []string{"//ts"},
+			expected:     true,
+		},
+		{
+			name:         "Skip attribute",
+			main:         `<a><b id="1">x</b></a>`,
+			test:         `<a><b id="2">x</b></a>`,
+			skipXMLPaths: []string{"/a/b/@id"},
+			expected:     true,
+		},
+		{
+			name:         "Anchored path does not match deeper elements",
+			main:         `<a><b><ts>1</ts></b></a>`,
+			test:         `<a><b><ts>2</ts></b></a>`,
+			skipXMLPaths: []string{"/a/ts"},
+			expected:     false,
+		},
+		{
+			name:        "Malformed document",
+			main:        `<a>`,
+			test:        `<a/>`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeConfig := config.ComputedRouteConfig{SkipXMLPaths: tt.skipXMLPaths}
+			got, err := XMLBodiesEqual([]byte(tt.main), []byte(tt.test), routeConfig)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("XMLBodiesEqual() error = %v, expectError %v", err, tt.expectError)
+			}
+			if got.Equal != tt.expected {
+				t.Errorf("XMLBodiesEqual() = %v, want %v", got.Equal, tt.expected)
+			}
+		})
+	}
+}
+
+func TestJSONBodiesEqual(t *testing.T) {
+	tests := []struct {
+		name          string
+		main          string
+		test          string
+		skipJSONPaths []string
+		expectedEqual bool
+		expectedDiff  []storage.BodyDiff
+	}{
+		{
+			name:          "Equal with different key order",
+			main:          `{"a":1,"b":[1,2]}`,
+			test:          `{"b":[1,2],"a":1}`,
+			expectedEqual: true,
+		},
+		{
+			name:          "Changed, added and removed members",
+			main:          `{"a":1,"b":{"c":"x"},"d":true}`,
+			test:          `{"a":2,"b":{"c":"x","e":null}}`,
+			expectedEqual: false,
+			expectedDiff: []storage.BodyDiff{
+				{Path: "a", Kind: storage.BodyDiffChanged, Main: "1", Test: "2"},
+				{Path: "b.e", Kind: storage.BodyDiffAdded, Test: "null"},
+				{Path: "d", Kind: storage.BodyDiffRemoved, Main: "true"},
+			},
+		},
+		{
+			name:          "Array elements",
+			main:          `{"items":[{"id":1},{"id":2}]}`,
+			test:          `{"items":[{"id":1},{"id":3},{"id":4}]}`,
+			expectedEqual: false,
+			expectedDiff: []storage.BodyDiff{
+				{Path: "items.1.id", Kind: storage.BodyDiffChanged, Main: "2", Test: "3"},
+				{Path: "items.2", Kind: storage.BodyDiffAdded, Test: `{"id":4}`},
+			},
+		},
+		{
+			name:          "Type change and escaped keys",
+			main:          `{"a.b":[1]}`,
+			test:          `{"a.b":{"0":1}}`,
+			expectedEqual: false,
+			expectedDiff: []storage.BodyDiff{
+				{Path: `a\.b`, Kind: storage.BodyDiffChanged, Main: "[1]", Test: `{"0":1}`},
+			},
+		},
+		{
+			name:          "Skipped JSON paths",
+			main:          `{"id":1,"ts":100}`,
+			test:          `{"id":1,"ts":200}`,
+			skipJSONPaths: []string{"ts"},
+			expectedEqual: true,
+		},
+		{
+			name:          "Skipped JSON path missing on one side",
+			main:          `{"id":1,"ts":100}`,
+			test:          `{"id":1}`,
+			skipJSONPaths: []string{"ts"},
+			expectedEqual: true,
+		},
+		{
+			name:          "Skipped JSON path does not hide other differences",
+			main:          `{"id":1,"ts":100}`,
+			test:          `{"id":2}`,
+			skipJSONPaths: []string{"ts"},
+			expectedEqual: false,
+			expectedDiff: []storage.BodyDiff{
+				{Path: "id", Kind: storage.BodyDiffChanged, Main: "1", Test: "2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeConfig := config.ComputedRouteConfig{SkipJSONPaths: tt.skipJSONPaths}
+			got, err := JSONBodiesEqual([]byte(tt.main), []byte(tt.test), routeConfig)
+			if err != nil {
+				t.Fatalf("JSONBodiesEqual() error = %v", err)
+			}
+			if got.Equal != tt.expectedEqual {
+				t.Errorf("JSONBodiesEqual() equal = %v, want %v", got.Equal, tt.expectedEqual)
+			}
+			if !reflect.DeepEqual(got.Diff, tt.expectedDiff) {
+				t.Errorf("JSONBodiesEqual() diff mismatch.\nGot:  %+v\nWant: %+v", got.Diff, tt.expectedDiff)
+			}
+		})
+	}
+}
+
+func TestJSONBodiesEqualWithRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		main     string
+		test     string
+		rules    []config.JSONRule
+		expected bool
+	}{
+		{
+			name:     "Float serialization differs without tolerance",
+			main:     `{"price":1.0}`,
+			test:     `{"price":1.0000001}`,
+			expected: false,
+		},
+		{
+			name:     "Absolute tolerance",
+			main:     `{"price":1.0}`,
+			test:     `{"price":1.0000001}`,
+			rules:    []config.JSONRule{{FloatTolerance: 0.000001}},
+			expected: true,
+		},
+		{
+			name:     "Relative tolerance",
+			main:     `{"total":1000}`,
+			test:     `{"total":1005}`,
+			rules:    []config.JSONRule{{FloatRelativeTolerance: 0.01}},
+			expected: true,
+		},
+		{
+			name:     "Tolerance outside of the rule path",
+			main:     `{"price":1.0,"count":1}`,
+			test:     `{"price":1.001,"count":1.001}`,
+			rules:    []config.JSONRule{{Path: "price", FloatTolerance: 0.01}},
+			expected: false,
+		},
+		{
+			name:     "Tolerance on array element paths",
+			main:     `{"items":[{"price":1.0},{"price":2.0}]}`,
+			test:     `{"items":[{"price":1.001},{"price":2.001}]}`,
+			rules:    []config.JSONRule{{Path: "items.#.price", FloatTolerance: 0.01}},
+			expected: true,
+		},
+		{
+			name:     "String and number without coercion",
+			main:     `{"id":42}`,
+			test:     `{"id":"42"}`,
+			expected: false,
+		},
+		{
+			name:     "String and number with coercion",
+			main:     `{"id":42}`,
+			test:     `{"id":"42"}`,
+			rules:    []config.JSONRule{{CoerceStrings: true}},
+			expected: true,
+		},
+		{
+			name:     "Different strings with coercion",
+			main:     `{"id":"042"}`,
+			test:     `{"id":"42"}`,
+			rules:    []config.JSONRule{{CoerceStrings: true}},
+			expected: false,
+		},
+		{
+			name:     "Null and missing without rule",
+			main:     `{"a":1,"b":null}`,
+			test:     `{"a":1}`,
+			expected: false,
+		},
+		{
+			name:     "Null equals missing",
+			main:     `{"a":1,"b":null}`,
+			test:     `{"a":1,"c":null}`,
+			rules:    []config.JSONRule{{NullEqualsMissing: true}},
+			expected: true,
+		},
+		{
+			name:     "Null array element does not equal a missing one",
+			main:     `[1,null]`,
+			test:     `[1]`,
+			rules:    []config.JSONRule{{NullEqualsMissing: true}},
+			expected: false,
+		},
+		{
+			name:     "Null member equals missing in array elements",
+			main:     `{"items":[{"a":1,"b":null}]}`,
+			test:     `{"items":[{"a":1}]}`,
+			rules:    []config.JSONRule{{NullEqualsMissing: true}},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeConfig := config.ComputedRouteConfig{JSONRules: tt.rules}
+			got, err := JSONBodiesEqual([]byte(tt.main), []byte(tt.test), routeConfig)
+			if err != nil {
+				t.Fatalf("JSONBodiesEqual() error = %v", err)
+			}
+			if got.Equal != tt.expected {
+				t.Errorf("JSONBodiesEqual() = %v, want %v (diff: %+v)", got.Equal, tt.expected, got.Diff)
+			}
+		})
+	}
+}
+
+func TestJSONBodiesEqualWithUnorderedArrays(t *testing.T) {
+	tests := []struct {
+		name         string
+		main         string
+		test         string
+		rules        []config.JSONRule
+		expectedDiff []storage.BodyDiff
+	}{
+		{
+			name: "Ordered by default",
+			main: `{"items":[1,2]}`,
+			test: `{"items":[2,1]}`,
+			expectedDiff: []storage.BodyDiff{
+				{Path: "items.0", Kind: storage.BodyDiffChanged, Main: "1", Test: "2"},
+				{Path: "items.1", Kind: storage.BodyDiffChanged, Main: "2", Test: "1"},
+			},
+		},
+		{
+			name:  "Multiset with different order",
+			main:  `{"items":[{"id":1},{"id":2},{"id":2}]}`,
+			test:  `{"items":[{"id":2},{"id":1},{"id":2}]}`,
+			rules: []config.JSONRule{{Path: "items", UnorderedArrays: true}},
+		},
+		{
+			name:  "Multiset with different multiplicity",
+			main:  `{"items":[1,2,2]}`,
+			test:  `{"items":[2,1,1]}`,
+			rules: []config.JSONRule{{Path: "items", UnorderedArrays: true}},
+			expectedDiff: []storage.BodyDiff{
+				{Path: "items.2", Kind: storage.BodyDiffRemoved, Main: "2"},
+				{Path: "items.2", Kind: storage.BodyDiffAdded, Test: "1"},
+			},
+		},
+		{
+			name:  "Multiset elements honor tolerances",
+			main:  `{"items":[1.0,2.0]}`,
+			test:  `{"items":[2.001,1.001]}`,
+			rules: []config.JSONRule{{Path: "items", UnorderedArrays: true, FloatTolerance: 0.01}},
+		},
+		{
+			name:  "Keyed set reports changed members precisely",
+			main:  `{"users":[{"id":1,"name":"a"},{"id":2,"name":"b"},{"id":3,"name":"c"}]}`,
+			test:  `{"users":[{"id":3,"name":"c"},{"id":4,"name":"d"},{"id":1,"name":"x"}]}`,
+			rules: []config.JSONRule{{Path: "users", ArrayKey: "id"}},
+			expectedDiff: []storage.BodyDiff{
+				{Path: "users.0.name", Kind: storage.BodyDiffChanged, Main: `"a"`, Test: `"x"`},
+				{Path: "users.1", Kind: storage.BodyDiffRemoved, Main: `{"id":2,"name":"b"}`},
+				{Path: "users.1", Kind: storage.BodyDiffAdded, Test: `{"id":4,"name":"d"}`},
+			},
+		},
+		{
+			name:  "Keyed set with elements missing the key",
+			main:  `{"users":[{"id":1},{"name":"n"}]}`,
+			test:  `{"users":[{"name":"n"},{"id":1}]}`,
+			rules: []config.JSONRule{{Path: "users", ArrayKey: "id"}},
+		},
+		{
+			name:  "Nested arrays of a keyed set stay ordered",
+			main:  `{"items":[{"id":1,"steps":["a","b"]}]}`,
+			test:  `{"items":[{"id":1,"steps":["b","a"]}]}`,
+			rules: []config.JSONRule{{Path: "items", ArrayKey: "id"}},
+			expectedDiff: []storage.BodyDiff{
+				{Path: "items.0.steps.0", Kind: storage.BodyDiffChanged, Main: `"a"`, Test: `"b"`},
+				{Path: "items.0.steps.1", Kind: storage.BodyDiffChanged, Main: `"b"`, Test: `"a"`},
+			},
+		},
+		{
+			name:  "Nested arrays of an unordered array stay ordered",
+			main:  `{"tags":[[1,2]]}`,
+			test:  `{"tags":[[2,1]]}`,
+			rules: []config.JSONRule{{Path: "tags", UnorderedArrays: true}},
+			expectedDiff: []storage.BodyDiff{
+				{Path: "tags.0", Kind: storage.BodyDiffRemoved, Main: "[1,2]"},
+				{Path: "tags.0", Kind: storage.BodyDiffAdded, Test: "[2,1]"},
+			},
+		},
+		{
+			name:  "Nested unordered arrays by their own rule",
+			main:  `{"tags":[[1,2],[3]]}`,
+			test:  `{"tags":[[3],[2,1]]}`,
+			rules: []config.JSONRule{{Path: "tags", UnorderedArrays: true}, {Path: "tags.#", UnorderedArrays: true}},
+		},
+		{
+			name:  "Keyed set with duplicated keys",
+			main:  `{"users":[{"id":1,"v":1},{"id":1,"v":2}]}`,
+			test:  `{"users":[{"id":1,"v":2},{"id":1,"v":1}]}`,
+			rules: []config.JSONRule{{Path: "users", ArrayKey: "id"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeConfig := config.ComputedRouteConfig{JSONRules: tt.rules}
+			got, err := JSONBodiesEqual([]byte(tt.main), []byte(tt.test), routeConfig)
+			if err != nil {
+				t.Fatalf("JSONBodiesEqual() error = %v", err)
+			}
+			if got.Equal != (len(tt.expectedDiff) == 0) {
+				t.Errorf("JSONBodiesEqual() equal = %v, want %v", got.Equal, len(tt.expectedDiff) == 0)
+			}
+			if !reflect.DeepEqual(got.Diff, tt.expectedDiff) {
+				t.Errorf("JSONBodiesEqual() diff mismatch.\nGot:  %+v\nWant: %+v", got.Diff, tt.expectedDiff)
+			}
+		})
+	}
+}
+
+func TestJSONBodiesEqualWithNormalizers(t *testing.T) {
+	tests := []struct {
+		name         string
+		main         string
+		test         string
+		normalizers  []config.JSONNormalizer
+		expectedDiff []storage.BodyDiff
+	}{
+		{
+			name:        "Remove members in array elements",
+			main:        `{"items":[{"id":1,"created_at":"a"},{"id":2,"created_at":"b"}]}`,
+			test:        `{"items":[{"id":1,"created_at":"c"},{"id":2}]}`,
+			normalizers: []config.JSONNormalizer{{Path: "items.#.created_at", Action: config.NormalizeRemove}},
+		},
+		{
+			name:        "Remove array elements",
+			main:        `{"items":[1,2,3]}`,
+			test:        `{"items":[4]}`,
+			normalizers: []config.JSONNormalizer{{Path: "items.#", Action: config.NormalizeRemove}},
+		},
+		{
+			name: "Replace with wildcard path",
+			main: `{"a":{"msg":"request req-123 failed"},"b":{"msg":"req-9"}}`,
+			test: `{"a":{"msg":"request req-456 failed"},"b":{"msg":"req-10"}}`,
+			normalizers: []config.JSONNormalizer{
+				{Path: "*.msg", Action: config.NormalizeReplace, Pattern: `req-[0-9]+`, Replacement: "req-N"},
+			},
+		},
+		{
+			name: "Replace every string value",
+			main: `{"a":"host-1","b":["host-2"]}`,
+			test: `{"a":"host-7","b":["host-8"]}`,
+			normalizers: []config.JSONNormalizer{
+				{Action: config.NormalizeReplace, Pattern: `host-[0-9]+`, Replacement: "host"},
+			},
+		},
+		{
+			name:        "Matching UUIDs",
+			main:        `{"id":"123e4567-e89b-12d3-a456-426614174000"}`,
+			test:        `{"id":"9b2f1c3e-0f4a-4e5b-8c6d-7e8f9a0b1c2d"}`,
+			normalizers: []config.JSONNormalizer{{Path: "id", Action: config.NormalizeFormat, Format: config.FormatUUID}},
+		},
+		{
+			name:        "Value not matching the UUID format",
+			main:        `{"id":"123e4567-e89b-12d3-a456-426614174000"}`,
+			test:        `{"id":"none"}`,
+			normalizers: []config.JSONNormalizer{{Path: "id", Action: config.NormalizeFormat, Format: config.FormatUUID}},
+			expectedDiff: []storage.BodyDiff{
+				{Path: "id", Kind: storage.BodyDiffChanged, Main: `"<uuid>"`, Test: `"none"`},
+			},
+		},
+		{
+			name:        "Matching RFC 3339 timestamps",
+			main:        `{"items":[{"created_at":"2024-01-02T15:04:05Z"}]}`,
+			test:        `{"items":[{"created_at":"2024-01-02T15:04:06.123+03:30"}]}`,
+			normalizers: []config.JSONNormalizer{{Path: "items.#.created_at", Action: config.NormalizeFormat, Format: config.FormatRFC3339}},
+		},
+		{
+			name:        "Matching epoch timestamps",
+			main:        `{"ts":1700000000,"ms":1700000000000}`,
+			test:        `{"ts":"1700000001","ms":1700000000001}`,
+			normalizers: []config.JSONNormalizer{{Path: "*", Action: config.NormalizeFormat, Format: config.FormatEpoch}},
+		},
+		{
+			name:        "Value not matching the epoch format",
+			main:        `{"ts":1700000000}`,
+			test:        `{"ts":17}`,
+			normalizers: []config.JSONNormalizer{{Path: "ts", Action: config.NormalizeFormat, Format: config.FormatEpoch}},
+			expectedDiff: []storage.BodyDiff{
+				{Path: "ts", Kind: storage.BodyDiffChanged, Main: `"<epoch>"`, Test: "17"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeConfig := config.ComputedRouteConfig{JSONNormalizers: tt.normalizers}
+			got, err := JSONBodiesEqual([]byte(tt.main), []byte(tt.test), routeConfig)
+			if err != nil {
+				t.Fatalf("JSONBodiesEqual() error = %v", err)
+			}
+			if got.Equal != (len(tt.expectedDiff) == 0) {
+				t.Errorf("JSONBodiesEqual() equal = %v, want %v", got.Equal, len(tt.expectedDiff) == 0)
+			}
+			if !reflect.DeepEqual(got.Diff, tt.expectedDiff) {
+				t.Errorf("JSONBodiesEqual() diff mismatch.\nGot:  %+v\nWant: %+v", got.Diff, tt.expectedDiff)
+			}
+		})
+	}
+}
+
+func TestCheckAssertion(t *testing.T) {
+	tests := []struct {
+		assertion string
+		wantErr   bool
+	}{
+		{"test.status < 500", false},
+		{"len(test.body.items) >= len(main.body.items)", false},
+		{`request.method == "GET" && test.headers["content-type"] == main.headers["content-type"]`, false},
+		{"test.status <", true},
+		{"unknown.status == 200", true},
+		{`"not a bool"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.assertion, func(t *testing.T) {
+			if err := CheckAssertion(tt.assertion); (err != nil) != tt.wantErr {
+				t.Errorf("CheckAssertion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFailedAssertions(t *testing.T) {
+	exchange := &Exchange{
+		Request: &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/api/orders"}},
+		Main: Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       []byte(`{"total":42.5,"items":[1,2]}`),
+			Duration:   10 * time.Millisecond,
+		},
+		Test: Response{
+			StatusCode: 201,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       []byte(`{"total":42.5,"items":[1,2,3]}`),
+			Duration:   40 * time.Millisecond,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		assertions []string
+		expected   []string
+	}{
+		{
+			name: "Passing assertions",
+			assertions: []string{
+				"test.status < 500",
+				"test.body.total == main.body.total",
+				"len(test.body.items) >= len(main.body.items)",
+				`test.headers["content-type"] == "application/json"`,
+				`request.path.startsWith("/api/")`,
+			},
+		},
+		{
+			name:       "Failed assertions",
+			assertions: []string{"test.status == main.status", "test.duration_ms < 2.0 * main.duration_ms", "size(test.body.items) > 0"},
+			expected:   []string{"test.status == main.status", "test.duration_ms < 2.0 * main.duration_ms"},
+		},
+		{
+			name:       "Assertion with an evaluation error",
+			assertions: []string{"test.body.missing == 1"},
+			expected:   []string{"test.body.missing == 1: no such key: missing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exchange.RouteConfig = config.ComputedRouteConfig{Assertions: tt.assertions}
+			if got := FailedAssertions(exchange); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("FailedAssertions() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
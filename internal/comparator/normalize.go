@@ -0,0 +1,151 @@
+package comparator
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/jsonpath"
+)
+
+var (
+	uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	// patterns caches the compiled patterns of the replace normalizers
+	patterns sync.Map
+)
+
+// jsonNormalizer rewrites decoded JSON values according to the skip JSON paths and the JSON normalizers of a route
+type jsonNormalizer struct {
+	normalizers []config.JSONNormalizer
+	paths       [][]jsonpath.Step
+	patterns    []*regexp.Regexp
+}
+
+func newJSONNormalizer(routeConfig config.ComputedRouteConfig) (*jsonNormalizer, error) {
+	n := &jsonNormalizer{}
+	for _, skipPath := range routeConfig.SkipJSONPaths {
+		n.normalizers = append(n.normalizers, config.JSONNormalizer{Path: skipPath, Action: config.NormalizeRemove})
+	}
+	n.normalizers = append(n.normalizers, routeConfig.JSONNormalizers...)
+
+	for _, normalizer := range n.normalizers {
+		var pattern *regexp.Regexp
+		if normalizer.Action == config.NormalizeReplace {
+			var err error
+			if pattern, err = compilePattern(normalizer.Pattern); err != nil {
+				return nil, err
+			}
+		}
+
+		n.paths = append(n.paths, jsonpath.ParsePattern(normalizer.Path))
+		n.patterns = append(n.patterns, pattern)
+	}
+
+	return n, nil
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid json_normalizers pattern %q: %w", pattern, err)
+	}
+	patterns.Store(pattern, re)
+
+	return re, nil
+}
+
+// normalize returns the normalized value at the path given by segments, and false when it has to be removed
+func (n *jsonNormalizer) normalize(segments []string, v interface{}) (interface{}, bool) {
+	for i, normalizer := range n.normalizers {
+		if n.paths[i] != nil && !jsonpath.Match(n.paths[i], segments) {
+			continue
+		}
+
+		switch normalizer.Action {
+		case config.NormalizeRemove:
+			return nil, false
+		case config.NormalizeReplace:
+			if s, ok := v.(string); ok {
+				v = n.patterns[i].ReplaceAllString(s, normalizer.Replacement)
+			}
+		case config.NormalizeFormat:
+			if matchesFormat(v, normalizer.Format) {
+				v = "<" + normalizer.Format + ">"
+			}
+		}
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			normalized, keep := n.normalize(jsonpath.Append(segments, key), child)
+			if !keep {
+				delete(value, key)
+				continue
+			}
+			value[key] = normalized
+		}
+	case []interface{}:
+		elements := value[:0]
+		for i, child := range value {
+			if normalized, keep := n.normalize(jsonpath.Append(segments, strconv.Itoa(i)), child); keep {
+				elements = append(elements, normalized)
+			}
+		}
+		v = elements
+	}
+
+	return v, true
+}
+
+// matchesFormat checks whether the decoded JSON value is in the format
+func matchesFormat(v interface{}, format string) bool {
+	switch format {
+	case config.FormatUUID:
+		s, ok := v.(string)
+		return ok && uuidRegexp.MatchString(s)
+	case config.FormatRFC3339:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := time.Parse(time.RFC3339Nano, s)
+		return err == nil
+	case config.FormatEpoch:
+		return isEpoch(v)
+	}
+
+	return false
+}
+
+// isEpoch checks whether the value is an integer Unix timestamp in seconds or milliseconds between 2001 and 2286
+func isEpoch(v interface{}) bool {
+	var f float64
+	switch value := v.(type) {
+	case float64:
+		f = value
+	case string:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		f = float64(i)
+	default:
+		return false
+	}
+
+	if f != math.Trunc(f) {
+		return false
+	}
+
+	return (f >= 1e9 && f < 1e10) || (f >= 1e12 && f < 1e13)
+}
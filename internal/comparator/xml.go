@@ -0,0 +1,191 @@
+package comparator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+)
+
+// xmlNode is the canonical form of an XML element. Names carry the namespace URI instead of the prefix, attributes are
+// sorted and insignificant whitespace is dropped.
+type xmlNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	text     string
+	children []*xmlNode
+}
+
+// XMLBodiesEqual compares the XML bodies canonically, ignoring whitespace, attribute order and namespace prefixes. The
+// skip XML paths of the route are removed from both documents before the comparison.
+func XMLBodiesEqual(main, test []byte, routeConfig config.ComputedRouteConfig) (Result, error) {
+	mainRoot, err := parseXML(main)
+	if err != nil {
+		return Result{}, err
+	}
+
+	testRoot, err := parseXML(test)
+	if err != nil {
+		return Result{}, err
+	}
+
+	for _, skipPath := range routeConfig.SkipXMLPaths {
+		steps, anchored := parseXMLPath(skipPath)
+		removeXMLPath(mainRoot, nil, steps, anchored)
+		removeXMLPath(testRoot, nil, steps, anchored)
+	}
+
+	return Result{Equal: xmlNodesEqual(mainRoot, testRoot)}, nil
+}
+
+// parseXML parses a document into its canonical tree and returns the root element
+func parseXML(b []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(b))
+	// Character sets other than UTF-8 are compared as they are
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name}
+			for _, attr := range t.Attr {
+				// Namespace declarations are already resolved into the names
+				if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					continue
+				}
+				node.attrs = append(node.attrs, attr)
+			}
+			sort.Slice(node.attrs, func(i, j int) bool {
+				if node.attrs[i].Name.Space != node.attrs[j].Name.Space {
+					return node.attrs[i].Name.Space < node.attrs[j].Name.Space
+				}
+				return node.attrs[i].Name.Local < node.attrs[j].Name.Local
+			})
+
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, errors.New("xml: multiple root elements")
+				}
+				root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) == 0 {
+				continue
+			}
+			if text := strings.TrimSpace(string(t)); text != "" {
+				stack[len(stack)-1].text += text
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("xml: no root element")
+	}
+
+	return root, nil
+}
+
+func xmlNodesEqual(a, b *xmlNode) bool {
+	if a.name != b.name || a.text != b.text || len(a.attrs) != len(b.attrs) || len(a.children) != len(b.children) {
+		return false
+	}
+
+	for i := range a.attrs {
+		if a.attrs[i] != b.attrs[i] {
+			return false
+		}
+	}
+
+	for i := range a.children {
+		if !xmlNodesEqual(a.children[i], b.children[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseXMLPath parses an XPath-like path into its steps. A path starting with a single "/" is anchored at the root
+// element, others ("//name", "name/child") match at any depth. The last step may be an attribute ("@id") and a step
+// may be "*" to match any element. Steps are matched against local names regardless of namespaces.
+func parseXMLPath(p string) (steps []string, anchored bool) {
+	anchored = strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//")
+	for _, step := range strings.Split(strings.Trim(p, "/"), "/") {
+		if step != "" {
+			steps = append(steps, step)
+		}
+	}
+
+	return steps, anchored
+}
+
+// removeXMLPath removes the children and attributes of node matching the path. ancestors are the local names of the
+// elements from the root to the parent of node.
+func removeXMLPath(node *xmlNode, ancestors []string, steps []string, anchored bool) {
+	if len(steps) == 0 {
+		return
+	}
+
+	chain := append(append([]string{}, ancestors...), node.name.Local)
+	last := steps[len(steps)-1]
+
+	if strings.HasPrefix(last, "@") {
+		if matchXMLChain(chain, steps[:len(steps)-1], anchored) {
+			attrs := node.attrs[:0]
+			for _, attr := range node.attrs {
+				if last[1:] != "*" && attr.Name.Local != last[1:] {
+					attrs = append(attrs, attr)
+				}
+			}
+			node.attrs = attrs
+		}
+	} else {
+		children := node.children[:0]
+		for _, child := range node.children {
+			if !matchXMLChain(append(chain, child.name.Local), steps, anchored) {
+				children = append(children, child)
+			}
+		}
+		node.children = children
+	}
+
+	for _, child := range node.children {
+		removeXMLPath(child, chain, steps, anchored)
+	}
+}
+
+// matchXMLChain checks whether the chain of element names from the root matches the steps
+func matchXMLChain(chain []string, steps []string, anchored bool) bool {
+	if len(steps) > len(chain) || (anchored && len(steps) != len(chain)) {
+		return false
+	}
+
+	offset := len(chain) - len(steps)
+	for i, step := range steps {
+		if step != "*" && step != chain[offset+i] {
+			return false
+		}
+	}
+
+	return true
+}
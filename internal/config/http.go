@@ -2,8 +2,14 @@ package config
 
 import (
 	"fmt"
+	"net/http"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/knadh/koanf"
 	"github.com/knadh/koanf/parsers/yaml"
@@ -21,8 +27,9 @@ var (
 	// HTTP is the config for Proksi HTTP
 	HTTP *HTTPConfig
 
-	// ComputedConfigs contains pre-computed route configurations for fast runtime lookup
-	ComputedConfigs *ComputedRouteConfigs
+	// computedConfigs contains the *ComputedRouteConfigs of pre-computed route configurations for fast runtime lookup,
+	// swapped on reloads
+	computedConfigs atomic.Value
 )
 
 var defaultHTTP = HTTPConfig{
@@ -43,25 +50,75 @@ var defaultHTTP = HTTPConfig{
 		CertificateFingerprint: "",
 	},
 	Upstreams: struct {
-		Main httpUpstream `koanf:"main"`
-		Test httpUpstream `koanf:"test"`
+		Main HTTPUpstream `koanf:"main"`
+		Test HTTPUpstream `koanf:"test"`
 	}{
-		Main: httpUpstream{Address: "127.0.0.1:8080"},
-		Test: httpUpstream{Address: "127.0.0.1:8081"},
+		Main: HTTPUpstream{
+			Address:               "127.0.0.1:8080",
+			Timeout:               0, // Responses of the main upstream are streamed to the client and may take long
+			DialTimeout:           5 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 60 * time.Second,
+			KeepAlive:             30 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   100,
+			HTTP2:                 true,
+		},
+		Test: HTTPUpstream{
+			Address:               "127.0.0.1:8081",
+			Timeout:               30 * time.Second,
+			DialTimeout:           5 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			KeepAlive:             30 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   100,
+			HTTP2:                 true,
+		},
 	},
 	Worker: worker{
 		Count:     50,
 		QueueSize: 2048,
 	},
+	Capture: Capture{
+		Enabled:     false,
+		Directory:   "capture",
+		Format:      CaptureFormatJSONL,
+		Probability: 1,
+		MaxFileSize: 100 << 20,
+		MaxFiles:    10,
+		QueueSize:   1024,
+	},
+	MaxCaptureSize: 10 << 20,
+	Admin: Admin{
+		Enabled: false,
+		Bind:    "127.0.0.1:9002",
+		Token:   "",
+		Persist: false,
+	},
 
 	// New per-route configuration defaults
 	GlobalConfig: GlobalConfig{
-		CompareHeaders:  true,
-		SkipHeaders:     []string{},
-		StoreReqBody:    false,
-		StoreRespBodies: true,
-		SkipJSONPaths:   []string{},
-		TestProbability: 100,
+		CompareHeaders:     true,
+		CompareBody:        true,
+		BodyCompareMode:    BodyCompareAuto,
+		SkipHeaders:        []string{},
+		StoreReqBody:       false,
+		StoreRespBodies:    true,
+		SkipJSONPaths:      []string{},
+		SkipXMLPaths:       []string{},
+		JSONRules:          []JSONRule{},
+		JSONNormalizers:    []JSONNormalizer{},
+		StatusEquivalences: []string{},
+		Assertions:         []string{},
+		RedactHeaders:      []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token"},
+		RedactJSONPaths:    []string{},
+		HashJSONPaths:      []string{},
+		RedactPatterns:     []string{},
+		TestProbability:    100,
+		DedupWindow:        time.Hour,
 	},
 	RouteConfigs: make(map[string]RouteConfig),
 	SkipRoutes:   []string{},
@@ -81,11 +138,22 @@ type HTTPConfig struct {
 	StorageType   string        `koanf:"storage_type"` // Storage backend type: "elasticsearch" or "stdout"
 	Elasticsearch Elasticsearch `koanf:"elasticsearch"`
 	Upstreams     struct {
-		Main httpUpstream `koanf:"main"`
-		Test httpUpstream `koanf:"test"`
+		Main HTTPUpstream `koanf:"main"`
+		Test HTTPUpstream `koanf:"test"`
 	} `koanf:"upstreams"`
 	Worker worker `koanf:"worker"`
 
+	// Capture writes sampled requests and the responses of the main upstream to files, which can be replayed against
+	// the test upstream with proksi-replay
+	Capture Capture `koanf:"capture"`
+
+	// MaxCaptureSize is the maximum number of bytes of the request and the main response bodies kept in memory for
+	// comparison. Bodies are streamed regardless of their size, but larger ones are not compared. 0 means unlimited.
+	MaxCaptureSize int64 `koanf:"max_capture_size"`
+
+	// Admin serves the API which shows and changes the route configurations at runtime
+	Admin Admin `koanf:"admin"`
+
 	// New per-route configuration
 	GlobalConfig GlobalConfig           `koanf:"global_config"`
 	RouteConfigs map[string]RouteConfig `koanf:"route_configs"`
@@ -98,8 +166,31 @@ type HTTPConfig struct {
 	CompareHeaders     bool     `koanf:"compare_headers"`      // Deprecated: use GlobalConfig.CompareHeaders
 }
 
-type httpUpstream struct {
+// HTTPUpstream is the config of an upstream and the transport used to send the requests to it
+type HTTPUpstream struct {
 	Address string `koanf:"address"`
+
+	Timeout               time.Duration `koanf:"timeout"`                 // Overall timeout of a request including reading the response body (0 = no timeout)
+	DialTimeout           time.Duration `koanf:"dial_timeout"`            // Timeout of establishing the TCP connection
+	TLSHandshakeTimeout   time.Duration `koanf:"tls_handshake_timeout"`   // Timeout of the TLS handshake
+	ResponseHeaderTimeout time.Duration `koanf:"response_header_timeout"` // Timeout of waiting for the response headers after writing the request
+	KeepAlive             time.Duration `koanf:"keep_alive"`              // Interval of TCP keep-alive probes (negative = disabled)
+	IdleConnTimeout       time.Duration `koanf:"idle_conn_timeout"`       // How long an idle connection remains in the pool (0 = no limit)
+	MaxIdleConns          int           `koanf:"max_idle_conns"`          // Maximum number of idle connections (0 = no limit)
+	MaxIdleConnsPerHost   int           `koanf:"max_idle_conns_per_host"` // Maximum number of idle connections per host
+	MaxConnsPerHost       int           `koanf:"max_conns_per_host"`      // Maximum number of connections per host (0 = no limit)
+	DisableKeepAlives     bool          `koanf:"disable_keep_alives"`     // Use each connection only for a single request
+	HTTP2                 bool          `koanf:"http2"`                   // Negotiate HTTP/2 on TLS connections
+
+	TLS upstreamTLS `koanf:"tls"`
+}
+
+type upstreamTLS struct {
+	CAFile             string `koanf:"ca_file"`              // PEM bundle of CAs to verify the upstream with, in addition to the system pool
+	CertFile           string `koanf:"cert_file"`            // PEM client certificate for mTLS
+	KeyFile            string `koanf:"key_file"`             // PEM private key of the client certificate
+	ServerName         string `koanf:"server_name"`          // Overrides the server name used for verification and SNI
+	InsecureSkipVerify bool   `koanf:"insecure_skip_verify"` // Do not verify the upstream certificate. Use only for testing
 }
 
 type worker struct {
@@ -107,37 +198,255 @@ type worker struct {
 	QueueSize uint `koanf:"queue_size"`
 }
 
+// Capture file formats
+const (
+	CaptureFormatJSONL = "jsonl" // One JSON object per line
+	CaptureFormatHAR   = "har"   // HTTP Archive 1.2
+)
+
+// Capture is the config of the traffic capture
+type Capture struct {
+	Enabled     bool   `koanf:"enabled"`
+	Directory   string `koanf:"directory"`     // Directory of the capture files, created if missing
+	Format      string `koanf:"format"`        // "jsonl" or "har"
+	Probability uint64 `koanf:"probability"`   // Percentage of the requests captured (0-100)
+	MaxFileSize int64  `koanf:"max_file_size"` // Size in bytes after which a new file is started
+	MaxFiles    int    `koanf:"max_files"`     // Number of files kept, the oldest ones are removed (0 = keep all)
+	QueueSize   uint   `koanf:"queue_size"`    // Captured requests waiting to be written, more are dropped
+}
+
+// Admin is the config of the admin API
+type Admin struct {
+	Enabled bool   `koanf:"enabled"`
+	Bind    string `koanf:"bind"`    // Address of the admin server, separate from the proxy and the metrics
+	Token   string `koanf:"token"`   // Bearer token required by every request
+	Persist bool   `koanf:"persist"` // Write the route changes to the config file as well
+}
+
+// Body comparison modes
+const (
+	BodyCompareAuto       = "auto"        // Comparison is chosen by the content type of the main upstream response
+	BodyCompareExact      = "exact"       // Bodies must be byte-for-byte equal
+	BodyCompareJSON       = "json"        // Bodies are compared as JSON regardless of the content type
+	BodyCompareIgnore     = "ignore"      // Bodies are not compared
+	BodyCompareLengthOnly = "length_only" // Only the body lengths are compared
+	BodyCompareHash       = "hash"        // SHA-256 digests of the bodies are compared, bodies are not kept in memory
+	BodyCompareStatusOnly = "status_only" // Only the status codes are compared, neither headers nor bodies
+)
+
+var bodyCompareModes = map[string]bool{
+	BodyCompareAuto:       true,
+	BodyCompareExact:      true,
+	BodyCompareJSON:       true,
+	BodyCompareIgnore:     true,
+	BodyCompareLengthOnly: true,
+	BodyCompareHash:       true,
+	BodyCompareStatusOnly: true,
+}
+
 // RouteConfig represents per-route configuration overrides
 type RouteConfig struct {
-	CompareHeaders  string   `koanf:"compare_headers"`   // Override global compare headers setting ("" = inherit, "enable"/"disable" = override)
-	CompareBody     string   `koanf:"compare_body"`      // Override global compare body setting ("" = inherit, "enable"/"disable" = override)
-	SkipHeaders     []string `koanf:"skip_headers"`      // Headers to skip during comparison
-	StoreReqBody    string   `koanf:"store_req_body"`    // Store request body on differences ("" = inherit, "enable"/"disable" = override)
-	StoreRespBodies string   `koanf:"store_resp_bodies"` // Store response bodies on differences ("" = inherit, "enable"/"disable" = override)
-	SkipJSONPaths   []string `koanf:"skip_json_paths"`   // Route-specific JSON paths to skip
-	TestProbability uint64   `koanf:"test_probability"`  // Override global test probability for this route (0 = inherit)
+	CompareHeaders        string           `koanf:"compare_headers"`         // Override global compare headers setting ("" = inherit, "enable"/"disable" = override)
+	CompareBody           string           `koanf:"compare_body"`            // Override global compare body setting ("" = inherit, "enable"/"disable" = override)
+	BodyCompareMode       string           `koanf:"body_compare_mode"`       // Override global body comparison mode ("" = inherit)
+	Comparator            string           `koanf:"comparator"`              // Name of the body comparator to use instead of the one of the content type ("" = by content type)
+	SkipHeaders           []string         `koanf:"skip_headers"`            // Headers to skip during comparison
+	StoreReqBody          string           `koanf:"store_req_body"`          // Store request body on differences ("" = inherit, "enable"/"disable" = override)
+	StoreRespBodies       string           `koanf:"store_resp_bodies"`       // Store response bodies on differences ("" = inherit, "enable"/"disable" = override)
+	StoreDiffOnly         string           `koanf:"store_diff_only"`         // Store only the structured body diff instead of the response bodies when available ("" = inherit, "enable"/"disable" = override)
+	CompareStatusClass    string           `koanf:"compare_status_class"`    // Compare only the class of the status codes, e.g. 2xx ("" = inherit, "enable"/"disable" = override)
+	StatusEquivalences    []string         `koanf:"status_equivalences"`     // Route-specific groups of equivalent status codes, e.g. "200,201"
+	SkipJSONPaths         []string         `koanf:"skip_json_paths"`         // Route-specific JSON paths to skip
+	SkipXMLPaths          []string         `koanf:"skip_xml_paths"`          // Route-specific XPath-like paths to skip
+	JSONRules             []JSONRule       `koanf:"json_rules"`              // Route-specific JSON comparison rules, added to the global ones
+	JSONNormalizers       []JSONNormalizer `koanf:"json_normalizers"`        // Route-specific JSON normalizers, applied after the global ones
+	Assertions            []string         `koanf:"assertions"`              // Route-specific CEL assertions, added to the global ones
+	RedactHeaders         []string         `koanf:"redact_headers"`          // Route-specific headers masked in stored records, added to the global ones
+	RedactJSONPaths       []string         `koanf:"redact_json_paths"`       // Route-specific JSON paths masked in stored records
+	HashJSONPaths         []string         `koanf:"hash_json_paths"`         // Route-specific JSON paths hashed in stored records
+	RedactPatterns        []string         `koanf:"redact_patterns"`         // Route-specific patterns masked in stored records
+	TestProbability       uint64           `koanf:"test_probability"`        // Override global test probability for this route (0 = inherit)
+	LatencyThreshold      time.Duration    `koanf:"latency_threshold"`       // Override global latency threshold (0 = inherit)
+	LatencyRatioThreshold float64          `koanf:"latency_ratio_threshold"` // Override global latency ratio threshold (0 = inherit)
+	DedupLimit            uint64           `koanf:"dedup_limit"`             // Override global dedup limit (0 = inherit)
+	DedupWindow           time.Duration    `koanf:"dedup_window"`            // Override global dedup window (0 = inherit)
+	Match                 RouteMatch       `koanf:"match"`                   // Conditions on the host, query and headers of the requests, besides the route pattern
 }
 
 // GlobalConfig represents global default configuration
 type GlobalConfig struct {
-	CompareHeaders  bool     `koanf:"compare_headers"`   // Default: true
-	CompareBody     bool     `koanf:"compare_body"`      // Default: true
-	SkipHeaders     []string `koanf:"skip_headers"`      // Global headers to skip
-	StoreReqBody    bool     `koanf:"store_req_body"`    // Default: false
-	StoreRespBodies bool     `koanf:"store_resp_bodies"` // Default: true (current LogResponsePayload)
-	SkipJSONPaths   []string `koanf:"skip_json_paths"`   // Global JSON paths to skip
-	TestProbability uint64   `koanf:"test_probability"`  // Default: 100
+	CompareHeaders        bool             `koanf:"compare_headers"`         // Default: true
+	CompareBody           bool             `koanf:"compare_body"`            // Default: true
+	BodyCompareMode       string           `koanf:"body_compare_mode"`       // Default: "auto"
+	SkipHeaders           []string         `koanf:"skip_headers"`            // Global headers to skip
+	StoreReqBody          bool             `koanf:"store_req_body"`          // Default: false
+	StoreRespBodies       bool             `koanf:"store_resp_bodies"`       // Default: true (current LogResponsePayload)
+	StoreDiffOnly         bool             `koanf:"store_diff_only"`         // Default: false
+	CompareStatusClass    bool             `koanf:"compare_status_class"`    // Default: false
+	StatusEquivalences    []string         `koanf:"status_equivalences"`     // Global groups of equivalent status codes
+	SkipJSONPaths         []string         `koanf:"skip_json_paths"`         // Global JSON paths to skip
+	SkipXMLPaths          []string         `koanf:"skip_xml_paths"`          // Global XPath-like paths to skip
+	JSONRules             []JSONRule       `koanf:"json_rules"`              // Global JSON comparison rules
+	JSONNormalizers       []JSONNormalizer `koanf:"json_normalizers"`        // Global JSON normalizers
+	Assertions            []string         `koanf:"assertions"`              // Global CEL assertions
+	RedactHeaders         []string         `koanf:"redact_headers"`          // Default: well-known auth headers
+	RedactJSONPaths       []string         `koanf:"redact_json_paths"`       // Global JSON paths masked in stored records
+	HashJSONPaths         []string         `koanf:"hash_json_paths"`         // Global JSON paths hashed in stored records
+	RedactPatterns        []string         `koanf:"redact_patterns"`         // Global patterns masked in stored records: "card", "email", "phone" or a regular expression
+	TestProbability       uint64           `koanf:"test_probability"`        // Default: 100
+	LatencyThreshold      time.Duration    `koanf:"latency_threshold"`       // Default: 0 (disabled)
+	LatencyRatioThreshold float64          `koanf:"latency_ratio_threshold"` // Default: 0 (disabled)
+	DedupLimit            uint64           `koanf:"dedup_limit"`             // Default: 0 (store every record)
+	DedupWindow           time.Duration    `koanf:"dedup_window"`            // Default: 1h
+}
+
+// JSONRule relaxes the JSON comparison for the values at a path and all their descendants. When several rules apply
+// to a value, the largest tolerances and every enabled flag are used, and the array key of the last rule wins.
+type JSONRule struct {
+	Path                   string  `koanf:"path" json:"path"`                                         // Path in the skip_json_paths syntax, "*" matches any key and "#" any array index ("" = the whole body)
+	FloatTolerance         float64 `koanf:"float_tolerance" json:"float_tolerance"`                   // Numbers are equal if their absolute difference is at most this value
+	FloatRelativeTolerance float64 `koanf:"float_relative_tolerance" json:"float_relative_tolerance"` // Numbers are equal if their difference relative to the larger one is at most this value
+	CoerceStrings          bool    `koanf:"coerce_strings" json:"coerce_strings"`                     // A string holding a number equals that number, e.g. "42" and 42
+	NullEqualsMissing      bool    `koanf:"null_equals_missing" json:"null_equals_missing"`           // A null member equals a missing one
+	UnorderedArrays        bool    `koanf:"unordered_arrays" json:"unordered_arrays"`                 // Arrays are compared as multisets, ignoring the order of their elements
+	ArrayKey               string  `koanf:"array_key" json:"array_key"`                               // Arrays are compared as sets of objects matched by this member, e.g. "id"
+}
+
+// JSON normalizer actions
+const (
+	NormalizeRemove  = "remove"  // Removes the member or the array element
+	NormalizeReplace = "replace" // Replaces the matches of a regular expression in string values
+	NormalizeFormat  = "format"  // Replaces values in a well-known format by a placeholder
+)
+
+// JSON normalizer formats
+const (
+	FormatUUID    = "uuid"    // e.g. "123e4567-e89b-12d3-a456-426614174000"
+	FormatRFC3339 = "rfc3339" // e.g. "2024-01-02T15:04:05Z"
+	FormatEpoch   = "epoch"   // Unix timestamps in seconds or milliseconds, as numbers or strings
+)
+
+// JSONNormalizer rewrites the JSON values at a path in both bodies before the comparison
+type JSONNormalizer struct {
+	Path        string `koanf:"path" json:"path"`               // Path in the skip_json_paths syntax, "*" matches any key and "#" any array index ("" = every value)
+	Action      string `koanf:"action" json:"action"`           // "remove", "replace" or "format"
+	Pattern     string `koanf:"pattern" json:"pattern"`         // Regular expression of the "replace" action
+	Replacement string `koanf:"replacement" json:"replacement"` // Replacement of the "replace" action, may refer to groups like ${1}
+	Format      string `koanf:"format" json:"format"`           // Format of the "format" action: "uuid", "rfc3339" or "epoch"
 }
 
 // ComputedRouteConfig represents a fully resolved route configuration for runtime use
 type ComputedRouteConfig struct {
-	CompareHeaders  bool     // Resolved boolean value
-	CompareBody     bool     // Resolved boolean value
-	SkipHeaders     []string // Headers to skip during comparison
-	StoreReqBody    bool     // Resolved boolean value
-	StoreRespBodies bool     // Resolved boolean value
-	SkipJSONPaths   []string // JSON paths to skip
-	TestProbability uint64   // Test probability percentage
+	Pattern               string           `json:"pattern"`                 // Route pattern of the config, empty for the global config
+	Match                 RouteMatch       `json:"match"`                   // Conditions on the requests besides the route pattern
+	CompareHeaders        bool             `json:"compare_headers"`         // Resolved boolean value
+	CompareBody           bool             `json:"compare_body"`            // Resolved boolean value
+	BodyCompareMode       string           `json:"body_compare_mode"`       // Resolved body comparison mode
+	Comparator            string           `json:"comparator"`              // Forced body comparator name, empty to select by content type
+	SkipHeaders           []string         `json:"skip_headers"`            // Headers to skip during comparison
+	StoreReqBody          bool             `json:"store_req_body"`          // Resolved boolean value
+	StoreRespBodies       bool             `json:"store_resp_bodies"`       // Resolved boolean value
+	StoreDiffOnly         bool             `json:"store_diff_only"`         // Resolved boolean value
+	CompareStatusClass    bool             `json:"compare_status_class"`    // Resolved boolean value
+	StatusEquivalences    []string         `json:"status_equivalences"`     // Groups of equivalent status codes
+	SkipJSONPaths         []string         `json:"skip_json_paths"`         // JSON paths to skip
+	SkipXMLPaths          []string         `json:"skip_xml_paths"`          // XPath-like paths to skip
+	JSONRules             []JSONRule       `json:"json_rules"`              // JSON comparison rules
+	JSONNormalizers       []JSONNormalizer `json:"json_normalizers"`        // JSON normalizers
+	Assertions            []string         `json:"assertions"`              // CEL assertions on the responses
+	RedactHeaders         []string         `json:"redact_headers"`          // Headers masked in stored records
+	RedactJSONPaths       []string         `json:"redact_json_paths"`       // JSON paths masked in stored records
+	HashJSONPaths         []string         `json:"hash_json_paths"`         // JSON paths hashed in stored records
+	RedactPatterns        []string         `json:"redact_patterns"`         // Patterns masked in stored records
+	TestProbability       uint64           `json:"test_probability"`        // Test probability percentage
+	LatencyThreshold      time.Duration    `json:"latency_threshold"`       // Minimum slowdown of the test upstream reported as a latency difference
+	LatencyRatioThreshold float64          `json:"latency_ratio_threshold"` // Minimum test/main duration ratio reported as a latency difference
+	DedupLimit            uint64           `json:"dedup_limit"`             // Records stored per fingerprint and window (0 = all)
+	DedupWindow           time.Duration    `json:"dedup_window"`            // Window of DedupLimit
+	Paused                bool             `json:"paused"`                  // Shadowing is paused through the admin API
+
+	statusGroups []map[int]bool // Parsed StatusEquivalences, set by PrecomputeRouteConfigs
+}
+
+// BodyComparison returns the effective body comparison mode, a disabled body comparison is the same as ignoring it
+func (c ComputedRouteConfig) BodyComparison() string {
+	if !c.CompareBody && c.BodyCompareMode != BodyCompareStatusOnly {
+		return BodyCompareIgnore
+	}
+
+	return c.BodyCompareMode
+}
+
+// StatusEquivalent checks whether the status codes of the main and test responses are considered the same, either
+// because they are equal, of the same class with CompareStatusClass, or in the same group of StatusEquivalences
+func (c ComputedRouteConfig) StatusEquivalent(main, test int) bool {
+	if main == test || (c.CompareStatusClass && main/100 == test/100) {
+		return true
+	}
+
+	groups := c.statusGroups
+	if len(groups) != len(c.StatusEquivalences) {
+		// Not pre-computed
+		groups = parseStatusGroups(c.StatusEquivalences)
+	}
+
+	for _, codes := range groups {
+		if codes[main] && codes[test] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseStatusGroups parses the groups of StatusEquivalences, which are validated at startup
+func parseStatusGroups(groups []string) []map[int]bool {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	parsed := make([]map[int]bool, len(groups))
+	for i, group := range groups {
+		parsed[i], _ = parseStatusGroup(group)
+	}
+
+	return parsed
+}
+
+// parseStatusGroup parses a comma separated group of status codes, e.g. "200,201,204"
+func parseStatusGroup(group string) (map[int]bool, error) {
+	codes := make(map[int]bool)
+	for _, code := range strings.Split(group, ",") {
+		status, err := strconv.Atoi(strings.TrimSpace(code))
+		if err != nil || status < 100 || status > 599 {
+			return nil, fmt.Errorf("invalid status code %q", strings.TrimSpace(code))
+		}
+		codes[status] = true
+	}
+
+	if len(codes) < 2 {
+		return nil, fmt.Errorf("a group needs at least two different status codes")
+	}
+
+	return codes, nil
+}
+
+// LatencyExceeded checks whether the test upstream is slower than the main upstream by more than every configured
+// latency threshold. It is always false when no threshold is configured.
+func (c ComputedRouteConfig) LatencyExceeded(main, test time.Duration) bool {
+	if c.LatencyThreshold <= 0 && c.LatencyRatioThreshold <= 0 {
+		return false
+	}
+
+	if c.LatencyThreshold > 0 && test-main <= c.LatencyThreshold {
+		return false
+	}
+
+	if c.LatencyRatioThreshold > 0 && (main <= 0 || float64(test)/float64(main) <= c.LatencyRatioThreshold) {
+		return false
+	}
+
+	return true
 }
 
 // ComputedRouteConfigs contains pre-computed route configurations for fast runtime lookup
@@ -150,42 +459,110 @@ type ComputedRouteConfigs struct {
 
 	// Skip routes for fast lookup: "GET:/health" -> true
 	SkipRoutes map[string]bool
+
+	// Compiled patterns of Routes and SkipRoutes
+	routeMatcher *RouteMatcher
+	skipMatcher  *RouteMatcher
+	// Compiles the patterns on the first lookup of configs which are not pre-computed
+	compileOnce sync.Once
 }
 
 // LoadHTTP function will load the file located in path and return the parsed config for ProksiHTTP. This function will panic on errors
 func LoadHTTP(path string) *HTTPConfig {
+	c, err := ParseHTTP(path)
+	if err != nil {
+		logging.L.Fatal(err.Error())
+	}
+
+	// Pre-compute route configurations for fast runtime lookup. Without validation it does not fail.
+	_ = Apply(c, nil)
+
+	HTTP = c
+	return c
+}
+
+// ParseHTTP loads and validates the file located in path without applying it, so that it can be used to reload the
+// route configurations
+func ParseHTTP(path string) (*HTTPConfig, error) {
+	c, err := readHTTP(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range c.validators() {
+		if err = v.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// readHTTP loads the file located in path over the default config without validating it
+func readHTTP(path string) (*HTTPConfig, error) {
 	// Create a fresh koanf instance for each load to avoid state pollution
 	localK := koanf.New(".")
 
 	// LoadHTTP default config in the beginning
 	err := localK.Load(structs.Provider(defaultHTTP, "koanf"), nil)
 	if err != nil {
-		logging.L.Fatal("error in loading the default config", zap.Error(err))
+		return nil, fmt.Errorf("error in loading the default config: %w", err)
 	}
 
 	// LoadHTTP YAML config and merge into the previously loaded config.
 	err = localK.Load(file.Provider(path), yaml.Parser())
 	if err != nil {
-		logging.L.Fatal("error in loading the config file", zap.Error(err))
+		return nil, fmt.Errorf("error in loading the config file: %w", err)
 	}
 
 	var c HTTPConfig
 	err = localK.Unmarshal("", &c)
 	if err != nil {
-		logging.L.Fatal("error in unmarshalling the config file", zap.Error(err))
+		return nil, fmt.Errorf("error in unmarshalling the config file: %w", err)
 	}
 
 	// Apply backward compatibility migrations
 	c.migrateFromLegacyConfig()
 
-	// Validate route patterns
-	c.validateRoutePatterns()
+	return &c, nil
+}
+
+// validator is a validation of the config
+type validator struct {
+	key      string // Key of the validated section, apart from route_configs
+	validate func() error
+}
+
+// validators returns the validations of the config, which also validate route_configs
+func (c *HTTPConfig) validators() []validator {
+	return []validator{
+		{"skip_routes", c.validateRoutePatterns},
+		{"global_config.body_compare_mode", c.validateBodyCompareModes},
+		{"global_config.json_rules", c.validateJSONRules},
+		{"global_config.json_normalizers", c.validateJSONNormalizers},
+		{"global_config.status_equivalences", c.validateStatusEquivalences},
+		{"global_config.latency_threshold", c.validateLatencyThresholds},
+		{"global_config.redact_patterns", c.validateRedactPatterns},
+		{"global_config.dedup_window", c.validateDedupWindows},
+		{"global_config.test_probability", c.validateTestProbabilities},
+		{"route_configs.match", c.validateRouteMatches},
+		{"upstreams", c.validateUpstreams},
+		{"capture", c.validateCapture},
+		{"admin", c.validateAdmin},
+	}
+}
 
-	// Pre-compute route configurations for fast runtime lookup
-	ComputedConfigs = c.PrecomputeRouteConfigs()
+// ComputedConfigs returns the current route configurations. Callers keep the returned snapshot for a whole request,
+// so that a reload in between does not mix two configurations.
+func ComputedConfigs() *ComputedRouteConfigs {
+	c, _ := computedConfigs.Load().(*ComputedRouteConfigs)
+	return c
+}
 
-	HTTP = &c
-	return &c
+// SetComputedConfigs atomically replaces the route configurations, compiling their patterns unless they are
+// pre-computed by PrecomputeRouteConfigs
+func SetComputedConfigs(c *ComputedRouteConfigs) {
+	computedConfigs.Store(c.matchers())
 }
 
 // migrateFromLegacyConfig migrates legacy configuration fields to new GlobalConfig structure
@@ -228,28 +605,300 @@ func (c *HTTPConfig) migrateFromLegacyConfig() {
 	}
 }
 
-// validateRoutePatterns validates route patterns at startup to catch invalid patterns early
-func (c *HTTPConfig) validateRoutePatterns() {
-	validatePatterns := func(routes []string, context string) {
+// validateRoutePatterns validates route patterns to catch invalid patterns early
+func (c *HTTPConfig) validateRoutePatterns() error {
+	validatePatterns := func(routes []string, context string, labels bool) error {
 		for _, route := range routes {
-			_, path := ParseRoute(route)
-			if !isValidRoutePattern(path) {
-				logging.L.Fatal(fmt.Sprintf("Invalid route pattern in %s: %s", context, route))
+			pattern := route
+			if labels {
+				// Keys of route configs may end with a non-empty "#label"
+				pattern = trimRouteLabel(route)
+				if len(pattern) == len(route)-1 {
+					return fmt.Errorf("invalid route pattern in %s: %s", context, route)
+				}
+			}
+
+			_, path := ParseRoute(pattern)
+			if !isValidRoutePattern(path) || strings.Contains(path, "#") {
+				return fmt.Errorf("invalid route pattern in %s: %s", context, route)
 			}
 		}
+		return nil
 	}
 
 	// Validate skip routes
-	validatePatterns(c.SkipRoutes, "skip_routes")
+	if err := validatePatterns(c.SkipRoutes, "skip_routes", false); err != nil {
+		return err
+	}
 
 	// Validate route configs
 	routeConfigKeys := make([]string, 0, len(c.RouteConfigs))
 	for route := range c.RouteConfigs {
 		routeConfigKeys = append(routeConfigKeys, route)
 	}
-	validatePatterns(routeConfigKeys, "route_configs")
+	return validatePatterns(routeConfigKeys, "route_configs", true)
 }
 
+// validateBodyCompareModes validates the global and per-route body comparison modes
+func (c *HTTPConfig) validateBodyCompareModes() error {
+	if !bodyCompareModes[c.GlobalConfig.BodyCompareMode] {
+		return fmt.Errorf("invalid body_compare_mode in global_config: %s", c.GlobalConfig.BodyCompareMode)
+	}
+
+	for route, routeConfig := range c.RouteConfigs {
+		if routeConfig.BodyCompareMode != "" && !bodyCompareModes[routeConfig.BodyCompareMode] {
+			return fmt.Errorf("invalid body_compare_mode in route_configs for %s: %s", route, routeConfig.BodyCompareMode)
+		}
+	}
+
+	return nil
+}
+
+// validateJSONRules validates the global and per-route JSON comparison rules
+func (c *HTTPConfig) validateJSONRules() error {
+	validateRules := func(rules []JSONRule, context string) error {
+		for _, rule := range rules {
+			if rule.FloatTolerance < 0 || rule.FloatRelativeTolerance < 0 {
+				return fmt.Errorf("negative float tolerance in json_rules of %s for path %q", context, rule.Path)
+			}
+		}
+		return nil
+	}
+
+	if err := validateRules(c.GlobalConfig.JSONRules, "global_config"); err != nil {
+		return err
+	}
+	for route, routeConfig := range c.RouteConfigs {
+		if err := validateRules(routeConfig.JSONRules, route); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Built-in redaction patterns
+const (
+	RedactCard  = "card"  // Payment card numbers passing the Luhn check
+	RedactEmail = "email" // Email addresses
+	RedactPhone = "phone" // International phone numbers starting with + or 00, and local ones starting with 0
+)
+
+// validateRedactPatterns validates the global and per-route redaction patterns
+func (c *HTTPConfig) validateRedactPatterns() error {
+	validatePatterns := func(patterns []string, context string) error {
+		for _, pattern := range patterns {
+			if pattern == RedactCard || pattern == RedactEmail || pattern == RedactPhone {
+				continue
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid redact_patterns in %s for pattern %q: %s", context, pattern, err)
+			}
+		}
+		return nil
+	}
+
+	if err := validatePatterns(c.GlobalConfig.RedactPatterns, "global_config"); err != nil {
+		return err
+	}
+	for route, routeConfig := range c.RouteConfigs {
+		if err := validatePatterns(routeConfig.RedactPatterns, route); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateUpstreams validates the addresses of the upstreams
+func (c *HTTPConfig) validateUpstreams() error {
+	if c.Upstreams.Main.Address == "" {
+		return fmt.Errorf("main upstream backend can not be empty")
+	}
+	if c.Upstreams.Test.Address == "" {
+		return fmt.Errorf("test upstream backend can not be empty")
+	}
+
+	return nil
+}
+
+// validateCapture validates the traffic capture config
+func (c *HTTPConfig) validateCapture() error {
+	if !c.Capture.Enabled {
+		return nil
+	}
+
+	if c.Capture.Directory == "" {
+		return fmt.Errorf("invalid capture: directory must not be empty")
+	}
+	if c.Capture.Format != CaptureFormatJSONL && c.Capture.Format != CaptureFormatHAR {
+		return fmt.Errorf("invalid capture format %q: must be %q or %q", c.Capture.Format, CaptureFormatJSONL, CaptureFormatHAR)
+	}
+	if c.Capture.Probability > 100 {
+		return fmt.Errorf("invalid capture probability %d: must be between 0 and 100", c.Capture.Probability)
+	}
+	if c.Capture.MaxFileSize <= 0 {
+		return fmt.Errorf("invalid capture max_file_size %d: must be positive", c.Capture.MaxFileSize)
+	}
+	if c.Capture.MaxFiles < 0 {
+		return fmt.Errorf("invalid capture max_files %d: must not be negative", c.Capture.MaxFiles)
+	}
+
+	return nil
+}
+
+// validateAdmin validates the admin API config
+func (c *HTTPConfig) validateAdmin() error {
+	if !c.Admin.Enabled {
+		return nil
+	}
+
+	if c.Admin.Bind == "" {
+		return fmt.Errorf("invalid admin: bind must not be empty")
+	}
+	if c.Admin.Token == "" {
+		return fmt.Errorf("invalid admin: token must not be empty")
+	}
+	if c.Admin.Bind == c.Bind || (c.Metrics.Enabled && c.Admin.Bind == c.Metrics.Bind) {
+		return fmt.Errorf("invalid admin bind %s: must differ from the proxy and the metrics binds", c.Admin.Bind)
+	}
+
+	return nil
+}
+
+// validateDedupWindows validates the global and per-route deduplication windows
+func (c *HTTPConfig) validateDedupWindows() error {
+	if c.GlobalConfig.DedupWindow <= 0 {
+		return fmt.Errorf("invalid dedup_window in global_config: %s must be positive", c.GlobalConfig.DedupWindow)
+	}
+	for route, routeConfig := range c.RouteConfigs {
+		if routeConfig.DedupWindow < 0 {
+			return fmt.Errorf("invalid dedup_window in %s: %s must not be negative", route, routeConfig.DedupWindow)
+		}
+	}
+
+	return nil
+}
+
+// validateRouteMatches validates the match conditions of the route configs
+func (c *HTTPConfig) validateRouteMatches() error {
+	for route, routeConfig := range c.RouteConfigs {
+		if err := routeConfig.Match.validate(); err != nil {
+			return fmt.Errorf("invalid match in route_configs for %s: %w", route, err)
+		}
+	}
+
+	return nil
+}
+
+// validateTestProbabilities validates the global and per-route test probabilities
+func (c *HTTPConfig) validateTestProbabilities() error {
+	if c.GlobalConfig.TestProbability > 100 {
+		return fmt.Errorf("invalid test_probability in global_config: %d must be between 0 and 100", c.GlobalConfig.TestProbability)
+	}
+	for route, routeConfig := range c.RouteConfigs {
+		if routeConfig.TestProbability > 100 {
+			return fmt.Errorf("invalid test_probability in route_configs for %s: %d must be between 0 and 100", route, routeConfig.TestProbability)
+		}
+	}
+
+	return nil
+}
+
+// validateLatencyThresholds validates the global and per-route latency thresholds
+func (c *HTTPConfig) validateLatencyThresholds() error {
+	validateThresholds := func(threshold time.Duration, ratio float64, context string) error {
+		if threshold < 0 {
+			return fmt.Errorf("invalid latency_threshold in %s: %s must not be negative", context, threshold)
+		}
+		if ratio < 0 || (ratio > 0 && ratio <= 1) {
+			return fmt.Errorf("invalid latency_ratio_threshold in %s: %g must be greater than 1", context, ratio)
+		}
+		return nil
+	}
+
+	if err := validateThresholds(c.GlobalConfig.LatencyThreshold, c.GlobalConfig.LatencyRatioThreshold, "global_config"); err != nil {
+		return err
+	}
+	for route, routeConfig := range c.RouteConfigs {
+		if err := validateThresholds(routeConfig.LatencyThreshold, routeConfig.LatencyRatioThreshold, route); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateStatusEquivalences validates the global and per-route groups of equivalent status codes
+func (c *HTTPConfig) validateStatusEquivalences() error {
+	validateGroups := func(groups []string, context string) error {
+		for _, group := range groups {
+			if _, err := parseStatusGroup(group); err != nil {
+				return fmt.Errorf("invalid status_equivalences in %s for group %q: %s", context, group, err)
+			}
+		}
+		return nil
+	}
+
+	if err := validateGroups(c.GlobalConfig.StatusEquivalences, "global_config"); err != nil {
+		return err
+	}
+	for route, routeConfig := range c.RouteConfigs {
+		if err := validateGroups(routeConfig.StatusEquivalences, route); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateJSONNormalizers validates the global and per-route JSON normalizers
+func (c *HTTPConfig) validateJSONNormalizers() error {
+	validateNormalizers := func(normalizers []JSONNormalizer, context string) error {
+		for _, normalizer := range normalizers {
+			if err := normalizer.validate(); err != nil {
+				return fmt.Errorf("invalid json_normalizers in %s for path %q: %s", context, normalizer.Path, err)
+			}
+		}
+		return nil
+	}
+
+	if err := validateNormalizers(c.GlobalConfig.JSONNormalizers, "global_config"); err != nil {
+		return err
+	}
+	for route, routeConfig := range c.RouteConfigs {
+		if err := validateNormalizers(routeConfig.JSONNormalizers, route); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n JSONNormalizer) validate() error {
+	switch n.Action {
+	case NormalizeRemove:
+		if n.Path == "" {
+			return fmt.Errorf("the remove action requires a path")
+		}
+	case NormalizeReplace:
+		if _, err := regexp.Compile(n.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	case NormalizeFormat:
+		if n.Format != FormatUUID && n.Format != FormatRFC3339 && n.Format != FormatEpoch {
+			return fmt.Errorf("unknown format %q", n.Format)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", n.Action)
+	}
+
+	return nil
+}
+
+// routeParamSegment matches the route parameters of a path pattern, e.g. "{id:[0-9]+}"
+var routeParamSegment = regexp.MustCompile(`\{[^/]*\}`)
+
 // isValidRoutePattern validates that a route pattern is well-formed
 func isValidRoutePattern(path string) bool {
 	// Empty path is invalid
@@ -262,7 +911,13 @@ func isValidRoutePattern(path string) bool {
 		return false
 	}
 
-	// Check for invalid wildcard combinations
+	// Route parameters must be whole segments with valid names and regexps
+	if _, err := parsePathPattern(path); err != nil {
+		return false
+	}
+
+	// Check for invalid wildcard combinations, outside of the regexps of route parameters
+	path = routeParamSegment.ReplaceAllString(path, "{}")
 	if strings.Contains(path, "**") {
 		return false // Double wildcards not supported
 	}
@@ -282,8 +937,9 @@ func FormatRoute(method, path string) string {
 
 // ParseRoute parses a route string into method and path components
 func ParseRoute(route string) (method, path string) {
+	// A ":" after a "/" is a part of the path, e.g. of a "{id:[0-9]+}" route parameter
 	parts := strings.SplitN(route, ":", 2)
-	if len(parts) == 2 {
+	if len(parts) == 2 && !strings.Contains(parts[0], "/") {
 		return parts[0], parts[1]
 	}
 	// If no method specified, assume wildcard
@@ -292,6 +948,12 @@ func ParseRoute(route string) (method, path string) {
 
 // MatchRoute checks if a request route matches a configured route pattern
 func MatchRoute(requestRoute, configRoute string) bool {
+	// Patterns with route parameters are compiled like the ones of route_configs
+	if hasRouteParams(configRoute) {
+		_, matched := routeParamsMatcher(configRoute).Match(requestRoute)
+		return matched
+	}
+
 	requestMethod, requestPath := ParseRoute(requestRoute)
 	configMethod, configPath := ParseRoute(configRoute)
 
@@ -337,9 +999,9 @@ func matchSegmentWildcards(requestPath, configPath string) bool {
 		}
 
 		if !hasOtherWildcards {
-			// This is a true trailing wildcard with no other wildcards
+			// This is a true trailing wildcard with no other wildcards, matching the prefix and the paths below it
 			prefix := strings.TrimSuffix(configPath, "/*")
-			return strings.HasPrefix(requestPath, prefix)
+			return requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/")
 		}
 	}
 
@@ -383,14 +1045,31 @@ func (c *HTTPConfig) PrecomputeRouteConfigs() *ComputedRouteConfigs {
 
 	// Pre-compute global config (with legacy migration applied)
 	computed.Global = ComputedRouteConfig{
-		CompareHeaders:  c.GlobalConfig.CompareHeaders,
-		CompareBody:     c.GlobalConfig.CompareBody,
-		SkipHeaders:     append([]string{}, c.GlobalConfig.SkipHeaders...),
-		StoreReqBody:    c.GlobalConfig.StoreReqBody,
-		StoreRespBodies: c.GlobalConfig.StoreRespBodies,
-		SkipJSONPaths:   append([]string{}, c.GlobalConfig.SkipJSONPaths...),
-		TestProbability: c.GlobalConfig.TestProbability,
+		CompareHeaders:        c.GlobalConfig.CompareHeaders,
+		CompareBody:           c.GlobalConfig.CompareBody,
+		BodyCompareMode:       c.GlobalConfig.BodyCompareMode,
+		SkipHeaders:           append([]string{}, c.GlobalConfig.SkipHeaders...),
+		StoreReqBody:          c.GlobalConfig.StoreReqBody,
+		StoreRespBodies:       c.GlobalConfig.StoreRespBodies,
+		StoreDiffOnly:         c.GlobalConfig.StoreDiffOnly,
+		CompareStatusClass:    c.GlobalConfig.CompareStatusClass,
+		StatusEquivalences:    append([]string{}, c.GlobalConfig.StatusEquivalences...),
+		SkipJSONPaths:         append([]string{}, c.GlobalConfig.SkipJSONPaths...),
+		SkipXMLPaths:          append([]string{}, c.GlobalConfig.SkipXMLPaths...),
+		JSONRules:             append([]JSONRule{}, c.GlobalConfig.JSONRules...),
+		JSONNormalizers:       append([]JSONNormalizer{}, c.GlobalConfig.JSONNormalizers...),
+		Assertions:            append([]string{}, c.GlobalConfig.Assertions...),
+		RedactHeaders:         append([]string{}, c.GlobalConfig.RedactHeaders...),
+		RedactJSONPaths:       append([]string{}, c.GlobalConfig.RedactJSONPaths...),
+		HashJSONPaths:         append([]string{}, c.GlobalConfig.HashJSONPaths...),
+		RedactPatterns:        append([]string{}, c.GlobalConfig.RedactPatterns...),
+		TestProbability:       c.GlobalConfig.TestProbability,
+		LatencyThreshold:      c.GlobalConfig.LatencyThreshold,
+		LatencyRatioThreshold: c.GlobalConfig.LatencyRatioThreshold,
+		DedupLimit:            c.GlobalConfig.DedupLimit,
+		DedupWindow:           c.GlobalConfig.DedupWindow,
 	}
+	computed.Global.statusGroups = parseStatusGroups(computed.Global.StatusEquivalences)
 
 	logging.L.Info("global config", zap.Any("config", computed.Global))
 
@@ -403,13 +1082,31 @@ func (c *HTTPConfig) PrecomputeRouteConfigs() *ComputedRouteConfigs {
 	for routePattern, routeConfig := range c.RouteConfigs {
 		// Start with global config as base
 		mergedConfig := ComputedRouteConfig{
-			CompareHeaders:  computed.Global.CompareHeaders,
-			CompareBody:     computed.Global.CompareBody,
-			SkipHeaders:     append([]string{}, computed.Global.SkipHeaders...),
-			StoreReqBody:    computed.Global.StoreReqBody,
-			StoreRespBodies: computed.Global.StoreRespBodies,
-			SkipJSONPaths:   append([]string{}, computed.Global.SkipJSONPaths...),
-			TestProbability: computed.Global.TestProbability,
+			Pattern:               routePattern,
+			Match:                 routeConfig.Match,
+			CompareHeaders:        computed.Global.CompareHeaders,
+			CompareBody:           computed.Global.CompareBody,
+			BodyCompareMode:       computed.Global.BodyCompareMode,
+			SkipHeaders:           append([]string{}, computed.Global.SkipHeaders...),
+			StoreReqBody:          computed.Global.StoreReqBody,
+			StoreRespBodies:       computed.Global.StoreRespBodies,
+			StoreDiffOnly:         computed.Global.StoreDiffOnly,
+			CompareStatusClass:    computed.Global.CompareStatusClass,
+			StatusEquivalences:    append([]string{}, computed.Global.StatusEquivalences...),
+			SkipJSONPaths:         append([]string{}, computed.Global.SkipJSONPaths...),
+			SkipXMLPaths:          append([]string{}, computed.Global.SkipXMLPaths...),
+			JSONRules:             append([]JSONRule{}, computed.Global.JSONRules...),
+			JSONNormalizers:       append([]JSONNormalizer{}, computed.Global.JSONNormalizers...),
+			Assertions:            append([]string{}, computed.Global.Assertions...),
+			RedactHeaders:         append([]string{}, computed.Global.RedactHeaders...),
+			RedactJSONPaths:       append([]string{}, computed.Global.RedactJSONPaths...),
+			HashJSONPaths:         append([]string{}, computed.Global.HashJSONPaths...),
+			RedactPatterns:        append([]string{}, computed.Global.RedactPatterns...),
+			TestProbability:       computed.Global.TestProbability,
+			LatencyThreshold:      computed.Global.LatencyThreshold,
+			LatencyRatioThreshold: computed.Global.LatencyRatioThreshold,
+			DedupLimit:            computed.Global.DedupLimit,
+			DedupWindow:           computed.Global.DedupWindow,
 		}
 
 		// Override with route-specific config using semantic keywords
@@ -428,6 +1125,11 @@ func (c *HTTPConfig) PrecomputeRouteConfigs() *ComputedRouteConfigs {
 		}
 		// Empty string means inherit from global (no override needed)
 
+		if routeConfig.BodyCompareMode != "" {
+			mergedConfig.BodyCompareMode = routeConfig.BodyCompareMode
+		}
+		mergedConfig.Comparator = routeConfig.Comparator
+
 		if routeConfig.StoreReqBody == "enable" {
 			mergedConfig.StoreReqBody = true
 		} else if routeConfig.StoreReqBody == "disable" {
@@ -442,56 +1144,152 @@ func (c *HTTPConfig) PrecomputeRouteConfigs() *ComputedRouteConfigs {
 		}
 		// Empty string means inherit from global (no override needed)
 
+		if routeConfig.StoreDiffOnly == "enable" {
+			mergedConfig.StoreDiffOnly = true
+		} else if routeConfig.StoreDiffOnly == "disable" {
+			mergedConfig.StoreDiffOnly = false
+		}
+		// Empty string means inherit from global (no override needed)
+
+		if routeConfig.CompareStatusClass == "enable" {
+			mergedConfig.CompareStatusClass = true
+		} else if routeConfig.CompareStatusClass == "disable" {
+			mergedConfig.CompareStatusClass = false
+		}
+		// Empty string means inherit from global (no override needed)
+
 		if len(routeConfig.SkipHeaders) > 0 {
 			mergedConfig.SkipHeaders = append(mergedConfig.SkipHeaders, routeConfig.SkipHeaders...)
 		}
+		if len(routeConfig.StatusEquivalences) > 0 {
+			mergedConfig.StatusEquivalences = append(mergedConfig.StatusEquivalences, routeConfig.StatusEquivalences...)
+		}
 		if len(routeConfig.SkipJSONPaths) > 0 {
 			mergedConfig.SkipJSONPaths = append(mergedConfig.SkipJSONPaths, routeConfig.SkipJSONPaths...)
 		}
+		if len(routeConfig.SkipXMLPaths) > 0 {
+			mergedConfig.SkipXMLPaths = append(mergedConfig.SkipXMLPaths, routeConfig.SkipXMLPaths...)
+		}
+		if len(routeConfig.JSONRules) > 0 {
+			mergedConfig.JSONRules = append(mergedConfig.JSONRules, routeConfig.JSONRules...)
+		}
+		if len(routeConfig.JSONNormalizers) > 0 {
+			mergedConfig.JSONNormalizers = append(mergedConfig.JSONNormalizers, routeConfig.JSONNormalizers...)
+		}
+		if len(routeConfig.Assertions) > 0 {
+			mergedConfig.Assertions = append(mergedConfig.Assertions, routeConfig.Assertions...)
+		}
+		if len(routeConfig.RedactHeaders) > 0 {
+			mergedConfig.RedactHeaders = append(mergedConfig.RedactHeaders, routeConfig.RedactHeaders...)
+		}
+		if len(routeConfig.RedactJSONPaths) > 0 {
+			mergedConfig.RedactJSONPaths = append(mergedConfig.RedactJSONPaths, routeConfig.RedactJSONPaths...)
+		}
+		if len(routeConfig.HashJSONPaths) > 0 {
+			mergedConfig.HashJSONPaths = append(mergedConfig.HashJSONPaths, routeConfig.HashJSONPaths...)
+		}
+		if len(routeConfig.RedactPatterns) > 0 {
+			mergedConfig.RedactPatterns = append(mergedConfig.RedactPatterns, routeConfig.RedactPatterns...)
+		}
 		if routeConfig.TestProbability > 0 {
 			mergedConfig.TestProbability = routeConfig.TestProbability
 		}
+		if routeConfig.LatencyThreshold > 0 {
+			mergedConfig.LatencyThreshold = routeConfig.LatencyThreshold
+		}
+		if routeConfig.LatencyRatioThreshold > 0 {
+			mergedConfig.LatencyRatioThreshold = routeConfig.LatencyRatioThreshold
+		}
+		if routeConfig.DedupLimit > 0 {
+			mergedConfig.DedupLimit = routeConfig.DedupLimit
+		}
+		if routeConfig.DedupWindow > 0 {
+			mergedConfig.DedupWindow = routeConfig.DedupWindow
+		}
 
 		// Store the pre-computed config
+		mergedConfig.statusGroups = parseStatusGroups(mergedConfig.StatusEquivalences)
 		computed.Routes[routePattern] = mergedConfig
 
 		logging.L.Info("route_config", zap.String("pattern", routePattern), zap.Any("config", mergedConfig))
 	}
 
+	computed.compile()
+
 	return computed
 }
 
-// GetRouteConfig returns pre-computed route configuration for runtime lookup
-func GetRouteConfig(route string) ComputedRouteConfig {
-	// Check for exact match first (for performance)
-	if config, exists := ComputedConfigs.Routes[route]; exists {
-		return config
+// compile compiles the patterns of the routes and skip routes for GetRouteConfig and IsRouteSkipped
+func (c *ComputedRouteConfigs) compile() {
+	routes := make([]string, 0, len(c.Routes))
+	for route := range c.Routes {
+		routes = append(routes, route)
+	}
+	skipRoutes := make([]string, 0, len(c.SkipRoutes))
+	for skipRoute, skipped := range c.SkipRoutes {
+		if skipped {
+			skipRoutes = append(skipRoutes, skipRoute)
+		}
 	}
 
-	// Check for pattern matches using MatchRoute
-	for configRoute, config := range ComputedConfigs.Routes {
-		if MatchRoute(route, configRoute) {
-			return config
+	matches := make(map[string]RouteMatch)
+	for route, routeConfig := range c.Routes {
+		if routeConfig.Match.Conditions() > 0 {
+			matches[route] = routeConfig.Match
 		}
 	}
 
-	// Return global config if no specific route config found
-	return ComputedConfigs.Global
+	c.routeMatcher = newRouteMatcher(routes, matches)
+	c.skipMatcher = NewRouteMatcher(skipRoutes)
 }
 
-// IsRouteSkipped checks if a route should be skipped using pre-computed lookup
+// GetRouteConfig returns pre-computed route configuration of the current route configurations
+func GetRouteConfig(route string) ComputedRouteConfig {
+	return ComputedConfigs().GetRouteConfig(route)
+}
+
+// GetRequestRouteConfig returns pre-computed route configuration of the route of the request r in the current route
+// configurations
+func GetRequestRouteConfig(route string, r *http.Request) ComputedRouteConfig {
+	return ComputedConfigs().GetRequestRouteConfig(route, r)
+}
+
+// IsRouteSkipped checks if a route should be skipped in the current route configurations
 func IsRouteSkipped(route string) bool {
-	// Check for exact match first (for performance)
-	if ComputedConfigs.SkipRoutes[route] {
-		return true
+	return ComputedConfigs().IsRouteSkipped(route)
+}
+
+// GetRouteConfig returns pre-computed route configuration for runtime lookup. Of the patterns matching the route,
+// the one taking precedence applies, see RouteMatcher. The route configs with match conditions never apply, see
+// GetRequestRouteConfig.
+func (c *ComputedRouteConfigs) GetRouteConfig(route string) ComputedRouteConfig {
+	return c.GetRequestRouteConfig(route, nil)
+}
+
+// GetRequestRouteConfig returns pre-computed route configuration of the route of the request r like GetRouteConfig,
+// evaluating the match conditions of the route configs on r. r may be nil.
+func (c *ComputedRouteConfigs) GetRequestRouteConfig(route string, r *http.Request) ComputedRouteConfig {
+	if pattern, ok := c.matchers().routeMatcher.MatchRequest(route, r); ok {
+		return c.Routes[pattern]
 	}
 
-	// Check for pattern matches using MatchRoute
-	for skipRoute := range ComputedConfigs.SkipRoutes {
-		if MatchRoute(route, skipRoute) {
-			return true
+	// Return global config if no specific route config found
+	return c.Global
+}
+
+// IsRouteSkipped checks if a route should be skipped using pre-computed lookup
+func (c *ComputedRouteConfigs) IsRouteSkipped(route string) bool {
+	_, ok := c.matchers().skipMatcher.Match(route)
+	return ok
+}
+
+// matchers returns c, compiling its patterns once when it is not compiled yet
+func (c *ComputedRouteConfigs) matchers() *ComputedRouteConfigs {
+	c.compileOnce.Do(func() {
+		if c.routeMatcher == nil {
+			c.compile()
 		}
-	}
+	})
 
-	return false
+	return c
 }
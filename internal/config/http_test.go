@@ -2,8 +2,12 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Helper function to convert bool to string for config
@@ -410,6 +414,224 @@ route_configs:
 	}
 }
 
+func TestConfigLoaderUpstreams(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "config_upstreams_test_*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(`
+upstreams:
+  main:
+    address: "https://main.local"
+    dial_timeout: 2s
+    max_conns_per_host: 10
+    http2: false
+    tls:
+      insecure_skip_verify: true
+  test:
+    address: "http://test.local"
+    timeout: 1m30s
+`)
+	if err != nil {
+		t.Fatalf("Failed to write to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	config := LoadHTTP(tmpFile.Name())
+
+	main := config.Upstreams.Main
+	if main.DialTimeout != 2*time.Second {
+		t.Errorf("Main DialTimeout: expected 2s, got %v", main.DialTimeout)
+	}
+	if main.MaxConnsPerHost != 10 {
+		t.Errorf("Main MaxConnsPerHost: expected 10, got %d", main.MaxConnsPerHost)
+	}
+	if main.HTTP2 {
+		t.Errorf("Main HTTP2: expected false, got true")
+	}
+	if !main.TLS.InsecureSkipVerify {
+		t.Errorf("Main InsecureSkipVerify: expected true, got false")
+	}
+	if main.ResponseHeaderTimeout != defaultHTTP.Upstreams.Main.ResponseHeaderTimeout {
+		t.Errorf("Main ResponseHeaderTimeout: expected default %v, got %v",
+			defaultHTTP.Upstreams.Main.ResponseHeaderTimeout, main.ResponseHeaderTimeout)
+	}
+
+	test := config.Upstreams.Test
+	if test.Timeout != 90*time.Second {
+		t.Errorf("Test Timeout: expected 1m30s, got %v", test.Timeout)
+	}
+	if !test.HTTP2 {
+		t.Errorf("Test HTTP2: expected default true, got false")
+	}
+}
+
+func TestConfigLoaderJSONRules(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "config_json_rules_test_*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(`
+global_config:
+  json_rules:
+    - float_tolerance: 0.0001
+route_configs:
+  "GET:/api/prices":
+    json_rules:
+      - path: "items.#.price"
+        float_relative_tolerance: 0.01
+        coerce_strings: true
+      - null_equals_missing: true
+`)
+	if err != nil {
+		t.Fatalf("Failed to write to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	LoadHTTP(tmpFile.Name())
+
+	expected := []JSONRule{
+		{FloatTolerance: 0.0001},
+		{Path: "items.#.price", FloatRelativeTolerance: 0.01, CoerceStrings: true},
+		{NullEqualsMissing: true},
+	}
+	if got := ComputedConfigs().Routes["GET:/api/prices"].JSONRules; !reflect.DeepEqual(got, expected) {
+		t.Errorf("JSONRules mismatch.\nGot:  %+v\nWant: %+v", got, expected)
+	}
+}
+
+func TestParseHTTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "Valid config",
+			content: `
+global_config:
+  test_probability: 50
+skip_routes: ["GET:/health"]
+`,
+		},
+		{
+			name: "Invalid body comparison mode",
+			content: `
+route_configs:
+  "GET:/api/users":
+    body_compare_mode: "bogus"
+`,
+			wantErr: "invalid body_compare_mode in route_configs for GET:/api/users: bogus",
+		},
+		{
+			name: "Route configs with match conditions",
+			content: `
+global_config:
+  test_probability: 50
+route_configs:
+  "GET:/api/reports":
+    test_probability: 10
+  "GET:/api/reports#csv":
+    test_probability: 20
+    match:
+      host: {equals: "api.example.com"}
+      query: [{name: "format", equals: "csv"}]
+      headers: [{name: "Accept", regex: "^text/"}]
+`,
+		},
+		{
+			name: "invalid match condition",
+			content: `
+route_configs:
+  "GET:/api/reports":
+    match:
+      query: [{name: "format", equals: "csv", present: true}]
+`,
+			wantErr: "invalid match in route_configs for GET:/api/reports: query[0] format: exactly one of equals, present and regex must be set",
+		},
+		{
+			name: "Empty route config label",
+			content: `
+route_configs:
+  "GET:/api/reports#":
+    test_probability: 20
+`,
+			wantErr: "invalid route pattern in route_configs: GET:/api/reports#",
+		},
+		{
+			name: "Admin without token",
+			content: `
+admin:
+  enabled: true
+`,
+			wantErr: "invalid admin: token must not be empty",
+		},
+		{
+			name: "Invalid YAML",
+			content: `
+global_config: [
+`,
+			wantErr: "error in loading the config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := &ComputedRouteConfigs{}
+			SetComputedConfigs(current)
+
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("Failed to write the config file: %v", err)
+			}
+
+			c, err := ParseHTTP(path)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("ParseHTTP() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("ParseHTTP() error = %v, want %q", err, tt.wantErr)
+			}
+			if err == nil && c.GlobalConfig.TestProbability != 50 {
+				t.Errorf("ParseHTTP() test_probability = %d, want 50", c.GlobalConfig.TestProbability)
+			}
+
+			// Parsing must not apply the config
+			if ComputedConfigs() != current {
+				t.Errorf("ParseHTTP() replaced the computed configs")
+			}
+		})
+	}
+}
+
+func TestJSONNormalizer_validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer JSONNormalizer
+		wantErr    bool
+	}{
+		{"remove", JSONNormalizer{Path: "items.#.created_at", Action: NormalizeRemove}, false},
+		{"remove without path", JSONNormalizer{Action: NormalizeRemove}, true},
+		{"replace", JSONNormalizer{Path: "message", Action: NormalizeReplace, Pattern: `req-[0-9]+`, Replacement: "req-N"}, false},
+		{"replace with invalid pattern", JSONNormalizer{Action: NormalizeReplace, Pattern: `(`}, true},
+		{"format", JSONNormalizer{Path: "*.id", Action: NormalizeFormat, Format: FormatEpoch}, false},
+		{"unknown format", JSONNormalizer{Action: NormalizeFormat, Format: "date"}, true},
+		{"unknown action", JSONNormalizer{Path: "id", Action: "skip"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.normalizer.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestFormatRoute(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -448,6 +670,8 @@ func TestParseRoute(t *testing.T) {
 		{"Empty route", "", "*", ""},
 		{"Only method", "GET:", "GET", ""},
 		{"Multiple colons", "GET:/api:test", "GET", "/api:test"},
+		{"Route parameter regexp", "GET:/users/{id:[0-9]+}", "GET", "/users/{id:[0-9]+}"},
+		{"No method with route parameter regexp", "/users/{id:[0-9]+}", "*", "/users/{id:[0-9]+}"},
 	}
 
 	for _, tt := range tests {
@@ -481,6 +705,8 @@ func TestMatchRoute(t *testing.T) {
 		{"Trailing wildcard match", "GET:/api/users/123", "GET:/api/users/*", true},
 		{"Trailing wildcard deep match", "GET:/api/users/123/profile/settings", "GET:/api/users/*", true},
 		{"Trailing wildcard no match", "GET:/api/orders", "GET:/api/users/*", false},
+		{"Trailing wildcard prefix path", "GET:/api/users", "GET:/api/users/*", true},
+		{"Trailing wildcard partial segment", "GET:/api/usersettings", "GET:/api/users/*", false},
 
 		// Single segment parameters
 		{"Single parameter match", "GET:/api/users/123/profile", "GET:/api/users/*/profile", true},
@@ -511,6 +737,16 @@ func TestMatchRoute(t *testing.T) {
 		// Go path.Match fallback patterns
 		{"Character class match", "GET:/users/123", "GET:/users/[0-9]*", false}, // Our implementation doesn't use path.Match for patterns with *
 		{"Character class no match", "GET:/users/abc", "GET:/users/[0-9]*", false},
+
+		// Named route parameters
+		{"Named parameter", "GET:/api/users/123/profile", "GET:/api/users/{id}/profile", true},
+		{"Named parameter missing segment", "GET:/api/users/profile", "GET:/api/users/{id}/profile", false},
+		{"Regexp parameter match", "GET:/api/users/123", "GET:/api/users/{id:[0-9]+}", true},
+		{"Regexp parameter no match", "GET:/api/users/me", "GET:/api/users/{id:[0-9]+}", false},
+		{"Regexp parameter whole segment", "GET:/api/users/123abc", "GET:/api/users/{id:[0-9]+}", false},
+		{"Rest parameter", "GET:/static/css/main.css", "GET:/static/{path...}", true},
+		{"Rest parameter of its prefix", "GET:/static", "GET:/static/{path...}", true},
+		{"Rest parameter partial segment", "GET:/statics/main.css", "GET:/static/{path...}", false},
 	}
 
 	for _, tt := range tests {
@@ -580,6 +816,8 @@ func TestMatchSegmentWildcards(t *testing.T) {
 		{"Pure trailing wildcard", "/api/users/123/anything", "/api/users/*", true},
 		{"Pure trailing wildcard no match", "/api/orders/123", "/api/users/*", false},
 		{"Root trailing wildcard", "/anything/here", "/*", true},
+		{"Trailing wildcard prefix path", "/api/users", "/api/users/*", true},
+		{"Trailing wildcard partial segment", "/api/usersettings", "/api/users/*", false},
 
 		// Segment-by-segment matching (patterns with other wildcards)
 		{"Mixed pattern not trailing", "/api/test/v1/users", "/api/*/v1/*", true},
@@ -624,6 +862,11 @@ func TestIsValidRoutePattern(t *testing.T) {
 		{"Single wildcard", "*", true},
 		{"Root parameter", "/*", true},
 		{"Multiple root parameters", "/*/*", true},
+		{"Named parameter", "/api/users/{id}/profile", true},
+		{"Regexp parameter", "/api/users/{id:[0-9]+}", true},
+		{"Regexp parameter with wildcards", "/files/{name:.*\\.pdf}", true},
+		{"Rest parameter", "/static/{path...}", true},
+		{"Named parameters with wildcards", "/api/{version}/*", true},
 
 		// Invalid patterns
 		{"Empty path", "", false},
@@ -631,6 +874,15 @@ func TestIsValidRoutePattern(t *testing.T) {
 		{"Double wildcards", "/api/**/users", false},
 		{"Invalid trailing wildcard", "/api/users*", false},
 		{"Invalid trailing pattern", "/api/test*", false},
+		{"Partial segment parameter", "/api/user{id}", false},
+		{"Unclosed parameter", "/api/{id", false},
+		{"Empty parameter name", "/api/{}", false},
+		{"Invalid parameter name", "/api/{user-id}", false},
+		{"Duplicate parameter names", "/api/{id}/items/{id}", false},
+		{"Invalid parameter regexp", "/api/{id:[0-9}", false},
+		{"Empty parameter regexp", "/api/{id:}", false},
+		{"Parameter regexp with slash", "/api/{path:a/b}", false},
+		{"Rest parameter not last", "/api/{path...}/items", false},
 
 		// Edge cases
 		{"Just slash and wildcard", "/*", true},
@@ -745,12 +997,26 @@ func TestHTTPConfig_migrateFromLegacyConfig(t *testing.T) {
 func TestHTTPConfig_PrecomputeRouteConfigs(t *testing.T) {
 	config := HTTPConfig{
 		GlobalConfig: GlobalConfig{
-			CompareHeaders:  true,
-			SkipHeaders:     []string{"Date", "Server"},
-			StoreReqBody:    false,
-			StoreRespBodies: true,
-			SkipJSONPaths:   []string{"timestamp"},
-			TestProbability: 100,
+			CompareHeaders:     true,
+			CompareBody:        true,
+			BodyCompareMode:    BodyCompareAuto,
+			SkipHeaders:        []string{"Date", "Server"},
+			StoreReqBody:       false,
+			StoreRespBodies:    true,
+			SkipJSONPaths:      []string{"timestamp"},
+			SkipXMLPaths:       []string{"//timestamp"},
+			JSONRules:          []JSONRule{{FloatTolerance: 0.001}},
+			JSONNormalizers:    []JSONNormalizer{{Path: "id", Action: NormalizeFormat, Format: FormatUUID}},
+			StatusEquivalences: []string{"200,201"},
+			Assertions:         []string{"test.status < 500"},
+			RedactHeaders:      []string{"Authorization"},
+			RedactJSONPaths:    []string{"password"},
+			HashJSONPaths:      []string{},
+			RedactPatterns:     []string{RedactEmail},
+			TestProbability:    100,
+			LatencyThreshold:   200 * time.Millisecond,
+			DedupLimit:         10,
+			DedupWindow:        time.Hour,
 		},
 		SkipRoutes: []string{
 			"GET:/health",
@@ -758,12 +1024,23 @@ func TestHTTPConfig_PrecomputeRouteConfigs(t *testing.T) {
 		},
 		RouteConfigs: map[string]RouteConfig{
 			"POST:/api/users": {
-				CompareHeaders:  "disable",
-				SkipHeaders:     []string{"Authorization"},
-				StoreReqBody:    "enable",
-				StoreRespBodies: "enable",
-				SkipJSONPaths:   []string{"password"},
-				TestProbability: 75,
+				CompareHeaders:        "disable",
+				BodyCompareMode:       BodyCompareHash,
+				SkipHeaders:           []string{"Authorization"},
+				StoreReqBody:          "enable",
+				StoreRespBodies:       "enable",
+				SkipJSONPaths:         []string{"password"},
+				SkipXMLPaths:          []string{"/user/password"},
+				JSONRules:             []JSONRule{{Path: "balance", CoerceStrings: true}},
+				JSONNormalizers:       []JSONNormalizer{{Path: "items.#.created_at", Action: NormalizeRemove}},
+				CompareStatusClass:    "enable",
+				StatusEquivalences:    []string{"200,204"},
+				TestProbability:       75,
+				LatencyRatioThreshold: 3,
+				Assertions:            []string{"test.body.id == main.body.id"},
+				RedactHeaders:         []string{"X-Session"},
+				HashJSONPaths:         []string{"user.national_id"},
+				DedupWindow:           time.Minute,
 			},
 			"GET:/api/orders/*": {
 				CompareHeaders:  "", // Inherit from global
@@ -780,12 +1057,27 @@ func TestHTTPConfig_PrecomputeRouteConfigs(t *testing.T) {
 
 	// Test global config
 	expectedGlobal := ComputedRouteConfig{
-		CompareHeaders:  true,
-		SkipHeaders:     []string{"Date", "Server"},
-		StoreReqBody:    false,
-		StoreRespBodies: true,
-		SkipJSONPaths:   []string{"timestamp"},
-		TestProbability: 100,
+		CompareHeaders:     true,
+		CompareBody:        true,
+		BodyCompareMode:    BodyCompareAuto,
+		SkipHeaders:        []string{"Date", "Server"},
+		StoreReqBody:       false,
+		StoreRespBodies:    true,
+		SkipJSONPaths:      []string{"timestamp"},
+		SkipXMLPaths:       []string{"//timestamp"},
+		JSONRules:          []JSONRule{{FloatTolerance: 0.001}},
+		JSONNormalizers:    []JSONNormalizer{{Path: "id", Action: NormalizeFormat, Format: FormatUUID}},
+		StatusEquivalences: []string{"200,201"},
+		Assertions:         []string{"test.status < 500"},
+		RedactHeaders:      []string{"Authorization"},
+		RedactJSONPaths:    []string{"password"},
+		HashJSONPaths:      []string{},
+		RedactPatterns:     []string{RedactEmail},
+		TestProbability:    100,
+		LatencyThreshold:   200 * time.Millisecond,
+		DedupLimit:         10,
+		DedupWindow:        time.Hour,
+		statusGroups:       []map[int]bool{{200: true, 201: true}},
 	}
 
 	if !reflect.DeepEqual(computed.Global, expectedGlobal) {
@@ -804,12 +1096,36 @@ func TestHTTPConfig_PrecomputeRouteConfigs(t *testing.T) {
 	// Test route-specific configs
 	// POST:/api/users should override all fields
 	expectedPostUsers := ComputedRouteConfig{
+		Pattern:         "POST:/api/users",
 		CompareHeaders:  false,                                       // Overridden
+		CompareBody:     true,                                        // From global
+		BodyCompareMode: BodyCompareHash,                             // Overridden
 		SkipHeaders:     []string{"Date", "Server", "Authorization"}, // Merged
 		StoreReqBody:    true,                                        // Overridden
 		StoreRespBodies: true,                                        // Overridden
 		SkipJSONPaths:   []string{"timestamp", "password"},           // Merged
+		SkipXMLPaths:    []string{"//timestamp", "/user/password"},   // Merged
 		TestProbability: 75,                                          // Overridden
+		JSONRules: []JSONRule{ // Merged
+			{FloatTolerance: 0.001},
+			{Path: "balance", CoerceStrings: true},
+		},
+		JSONNormalizers: []JSONNormalizer{ // Merged
+			{Path: "id", Action: NormalizeFormat, Format: FormatUUID},
+			{Path: "items.#.created_at", Action: NormalizeRemove},
+		},
+		CompareStatusClass:    true,                                                          // Overridden
+		StatusEquivalences:    []string{"200,201", "200,204"},                                // Merged
+		LatencyThreshold:      200 * time.Millisecond,                                        // From global
+		LatencyRatioThreshold: 3,                                                             // Overridden
+		Assertions:            []string{"test.status < 500", "test.body.id == main.body.id"}, // Merged
+		RedactHeaders:         []string{"Authorization", "X-Session"},                        // Merged
+		RedactJSONPaths:       []string{"password"},                                          // From global
+		HashJSONPaths:         []string{"user.national_id"},                                  // Merged
+		RedactPatterns:        []string{RedactEmail},                                         // From global
+		DedupLimit:            10,                                                            // From global
+		DedupWindow:           time.Minute,                                                   // Overridden
+		statusGroups:          []map[int]bool{{200: true, 201: true}, {200: true, 204: true}},
 	}
 
 	if gotConfig, exists := computed.Routes["POST:/api/users"]; !exists {
@@ -822,12 +1138,30 @@ func TestHTTPConfig_PrecomputeRouteConfigs(t *testing.T) {
 
 	// GET:/api/orders/* should inherit some fields and override others
 	expectedGetOrders := ComputedRouteConfig{
+		Pattern:         "GET:/api/orders/*",
 		CompareHeaders:  true,                                 // From global (inherited via nil pointer)
+		CompareBody:     true,                                 // From global
+		BodyCompareMode: BodyCompareAuto,                      // From global
 		SkipHeaders:     []string{"Date", "Server", "Cookie"}, // Merged
 		StoreReqBody:    false,                                // From global (inherited via nil pointer)
 		StoreRespBodies: true,                                 // From global (inherited via nil pointer)
 		SkipJSONPaths:   []string{"timestamp", "internal_id"}, // Merged
+		SkipXMLPaths:    []string{"//timestamp"},              // From global
+		JSONRules:       []JSONRule{{FloatTolerance: 0.001}},  // From global
 		TestProbability: 50,                                   // Overridden
+		JSONNormalizers: []JSONNormalizer{ // From global
+			{Path: "id", Action: NormalizeFormat, Format: FormatUUID},
+		},
+		StatusEquivalences: []string{"200,201"},           // From global
+		Assertions:         []string{"test.status < 500"}, // From global
+		RedactHeaders:      []string{"Authorization"},     // From global
+		RedactJSONPaths:    []string{"password"},          // From global
+		HashJSONPaths:      []string{},                    // From global
+		RedactPatterns:     []string{RedactEmail},         // From global
+		LatencyThreshold:   200 * time.Millisecond,        // From global
+		DedupLimit:         10,                            // From global
+		DedupWindow:        time.Hour,                     // From global
+		statusGroups:       []map[int]bool{{200: true, 201: true}},
 	}
 
 	if gotConfig, exists := computed.Routes["GET:/api/orders/*"]; !exists {
@@ -839,9 +1173,112 @@ func TestHTTPConfig_PrecomputeRouteConfigs(t *testing.T) {
 	}
 }
 
+func TestComputedRouteConfig_BodyComparison(t *testing.T) {
+	tests := []struct {
+		name        string
+		compareBody bool
+		mode        string
+		expected    string
+	}{
+		{"Enabled body comparison keeps the mode", true, BodyCompareJSON, BodyCompareJSON},
+		{"Disabled body comparison ignores the body", false, BodyCompareJSON, BodyCompareIgnore},
+		{"Disabled body comparison keeps status only", false, BodyCompareStatusOnly, BodyCompareStatusOnly},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := ComputedRouteConfig{CompareBody: tt.compareBody, BodyCompareMode: tt.mode}
+			if got := c.BodyComparison(); got != tt.expected {
+				t.Errorf("BodyComparison() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestComputedRouteConfig_StatusEquivalent(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     ComputedRouteConfig
+		main, test int
+		equivalent bool
+	}{
+		{"equal", ComputedRouteConfig{}, 200, 200, true},
+		{"different", ComputedRouteConfig{}, 200, 201, false},
+		{"same class", ComputedRouteConfig{CompareStatusClass: true}, 200, 204, true},
+		{"different class", ComputedRouteConfig{CompareStatusClass: true}, 200, 500, false},
+		{"same group", ComputedRouteConfig{StatusEquivalences: []string{"200, 201"}}, 201, 200, true},
+		{"other group", ComputedRouteConfig{StatusEquivalences: []string{"200,201", "200,204"}}, 200, 204, true},
+		{"not transitive", ComputedRouteConfig{StatusEquivalences: []string{"200,201", "200,204"}}, 201, 204, false},
+		{"outside the groups", ComputedRouteConfig{StatusEquivalences: []string{"200,201"}}, 200, 500, false},
+		{
+			name:       "pre-computed groups",
+			config:     ComputedRouteConfig{StatusEquivalences: []string{"200,201"}, statusGroups: []map[int]bool{{200: true, 204: true}}},
+			main:       200,
+			test:       204,
+			equivalent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.StatusEquivalent(tt.main, tt.test); got != tt.equivalent {
+				t.Errorf("StatusEquivalent(%d, %d) = %v, want %v", tt.main, tt.test, got, tt.equivalent)
+			}
+		})
+	}
+}
+
+func TestComputedRouteConfig_LatencyExceeded(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     ComputedRouteConfig
+		main, test time.Duration
+		exceeded   bool
+	}{
+		{"no threshold", ComputedRouteConfig{}, 10 * time.Millisecond, time.Second, false},
+		{"absolute exceeded", ComputedRouteConfig{LatencyThreshold: 100 * time.Millisecond}, 100 * time.Millisecond, 250 * time.Millisecond, true},
+		{"absolute not exceeded", ComputedRouteConfig{LatencyThreshold: 100 * time.Millisecond}, 100 * time.Millisecond, 200 * time.Millisecond, false},
+		{"ratio exceeded", ComputedRouteConfig{LatencyRatioThreshold: 3}, 10 * time.Millisecond, 31 * time.Millisecond, true},
+		{"ratio not exceeded", ComputedRouteConfig{LatencyRatioThreshold: 3}, 10 * time.Millisecond, 30 * time.Millisecond, false},
+		{"faster test upstream", ComputedRouteConfig{LatencyRatioThreshold: 3}, 30 * time.Millisecond, 10 * time.Millisecond, false},
+		{"both exceeded", ComputedRouteConfig{LatencyThreshold: 50 * time.Millisecond, LatencyRatioThreshold: 2}, 100 * time.Millisecond, 300 * time.Millisecond, true},
+		{"only ratio exceeded", ComputedRouteConfig{LatencyThreshold: 50 * time.Millisecond, LatencyRatioThreshold: 2}, time.Millisecond, 5 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.LatencyExceeded(tt.main, tt.test); got != tt.exceeded {
+				t.Errorf("LatencyExceeded(%s, %s) = %v, want %v", tt.main, tt.test, got, tt.exceeded)
+			}
+		})
+	}
+}
+
+func TestParseStatusGroup(t *testing.T) {
+	tests := []struct {
+		group   string
+		wantErr bool
+	}{
+		{"200,201", false},
+		{" 200 , 204 ,201", false},
+		{"200", true},
+		{"200,200", true},
+		{"200,2xx", true},
+		{"200,600", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.group, func(t *testing.T) {
+			if _, err := parseStatusGroup(tt.group); (err != nil) != tt.wantErr {
+				t.Errorf("parseStatusGroup(%q) error = %v, wantErr %v", tt.group, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestGetRouteConfig(t *testing.T) {
-	// Set up ComputedConfigs for testing
-	ComputedConfigs = &ComputedRouteConfigs{
+	// Set up the computed configs for testing
+	SetComputedConfigs(&ComputedRouteConfigs{
 		Global: ComputedRouteConfig{
 			CompareHeaders:  true,
 			SkipHeaders:     []string{"Date"},
@@ -868,7 +1305,7 @@ func TestGetRouteConfig(t *testing.T) {
 		SkipRoutes: map[string]bool{
 			"GET:/health": true,
 		},
-	}
+	})
 
 	tests := []struct {
 		name     string
@@ -932,14 +1369,14 @@ func TestGetRouteConfig(t *testing.T) {
 }
 
 func TestIsRouteSkipped(t *testing.T) {
-	// Set up ComputedConfigs for testing
-	ComputedConfigs = &ComputedRouteConfigs{
+	// Set up the computed configs for testing
+	SetComputedConfigs(&ComputedRouteConfigs{
 		SkipRoutes: map[string]bool{
 			"GET:/health": true,
 			"*:/metrics":  true,
 			"POST:/debug": true,
 		},
-	}
+	})
 
 	tests := []struct {
 		name     string
@@ -966,6 +1403,38 @@ func TestIsRouteSkipped(t *testing.T) {
 }
 
 // Benchmark tests for performance validation
+func TestComputedRouteConfigs_matchers(t *testing.T) {
+	// Configs which are not pre-computed are compiled once, on their first lookup
+	computed := &ComputedRouteConfigs{
+		Routes:     map[string]ComputedRouteConfig{"GET:/api/users/*": {TestProbability: 50}},
+		SkipRoutes: map[string]bool{"GET:/health": true},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := computed.GetRouteConfig("GET:/api/users/42").TestProbability; got != 50 {
+				t.Errorf("GetRouteConfig().TestProbability = %d, want 50", got)
+			}
+			if !computed.IsRouteSkipped("GET:/health") {
+				t.Error("IsRouteSkipped() = false, want true")
+			}
+		}()
+	}
+	wg.Wait()
+
+	routeMatcher := computed.routeMatcher
+	if routeMatcher == nil {
+		t.Fatal("routeMatcher is not compiled")
+	}
+	computed.GetRouteConfig("GET:/api/users/42")
+	if computed.routeMatcher != routeMatcher {
+		t.Error("routeMatcher is compiled again")
+	}
+}
+
 func BenchmarkMatchRoute(b *testing.B) {
 	testCases := []struct {
 		name         string
@@ -989,8 +1458,8 @@ func BenchmarkMatchRoute(b *testing.B) {
 }
 
 func BenchmarkGetRouteConfig(b *testing.B) {
-	// Set up realistic ComputedConfigs
-	ComputedConfigs = &ComputedRouteConfigs{
+	// Set up realistic computed configs
+	SetComputedConfigs(&ComputedRouteConfigs{
 		Global: ComputedRouteConfig{
 			CompareHeaders:  true,
 			TestProbability: 100,
@@ -1000,7 +1469,7 @@ func BenchmarkGetRouteConfig(b *testing.B) {
 			"GET:/api/orders/*": {TestProbability: 50},
 			"PUT:/api/products": {TestProbability: 90},
 		},
-	}
+	})
 
 	routes := []string{
 		"POST:/api/users",
@@ -1017,15 +1486,15 @@ func BenchmarkGetRouteConfig(b *testing.B) {
 }
 
 func BenchmarkIsRouteSkipped(b *testing.B) {
-	// Set up realistic ComputedConfigs
-	ComputedConfigs = &ComputedRouteConfigs{
+	// Set up realistic computed configs
+	SetComputedConfigs(&ComputedRouteConfigs{
 		SkipRoutes: map[string]bool{
 			"GET:/health":    true,
 			"GET:/metrics":   true,
 			"*:/static/*":    true,
 			"OPTIONS:/api/*": true,
 		},
-	}
+	})
 
 	routes := []string{
 		"GET:/health",
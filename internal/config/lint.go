@@ -0,0 +1,266 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Severities of the issues of a config
+const (
+	SeverityError   = "error"   // The config is rejected
+	SeverityWarning = "warning" // The config is accepted, but probably does not do what is intended
+)
+
+// Issue is a problem of a config found by linting it
+type Issue struct {
+	Severity string // "error" or "warning"
+	Key      string // Key of the config the issue is about, e.g. "route_configs.GET:/api/users/*"
+	Message  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Key, i.Message)
+}
+
+// RouteConfigKey returns the key of the route config of pattern in issues
+func RouteConfigKey(pattern string) string {
+	return "route_configs." + pattern
+}
+
+// LintHTTP loads the file located in path like ParseHTTP, but returns the issues of the config instead of failing on
+// its first error. It only fails when the file can not be loaded.
+func LintHTTP(path string) (*HTTPConfig, []Issue, error) {
+	c, err := readHTTP(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, c.Lint(), nil
+}
+
+// Lint returns the errors of every section and route config of c, which ParseHTTP reports one at a time, and warns
+// about route configs which are shadowed by other patterns or skipped
+func (c *HTTPConfig) Lint() []Issue {
+	var issues []Issue
+
+	// The sections apart from route_configs
+	sections := *c
+	sections.RouteConfigs = nil
+	for _, v := range sections.validators() {
+		if err := v.validate(); err != nil {
+			issues = append(issues, Issue{Severity: SeverityError, Key: v.key, Message: err.Error()})
+		}
+	}
+
+	// Every route config on its own, in the valid default config
+	patterns := sortedPatterns(c.RouteConfigs)
+	for _, pattern := range patterns {
+		route := defaultHTTP
+		route.RouteConfigs = map[string]RouteConfig{pattern: c.RouteConfigs[pattern]}
+		for _, v := range route.validators() {
+			if err := v.validate(); err != nil {
+				issues = append(issues, Issue{Severity: SeverityError, Key: RouteConfigKey(pattern), Message: err.Error()})
+			}
+		}
+	}
+
+	return append(issues, c.lintRoutePatterns(patterns)...)
+}
+
+// lintRoutePatterns warns about the route configs of patterns which are never used because skip_routes or a pattern
+// taking precedence cover them, and the ones which partially overlap with a pattern taking precedence. Patterns are
+// keys of route_configs, which may end with a "#label".
+func (c *HTTPConfig) lintRoutePatterns(patterns []string) []Issue {
+	var issues []Issue
+	for _, pattern := range patterns {
+		if !isValidRoute(pattern) {
+			// Reported as an error
+			continue
+		}
+
+		for _, skipRoute := range c.SkipRoutes {
+			if isValidRoute(skipRoute) && routeCovers(skipRoute, pattern) {
+				issues = append(issues, Issue{
+					Severity: SeverityWarning,
+					Key:      RouteConfigKey(pattern),
+					Message:  fmt.Sprintf("Unreachable route config: its requests are skipped by %s in skip_routes", skipRoute),
+				})
+				break
+			}
+		}
+
+		// Unreachable patterns are reported once, with the first pattern covering them. The patterns with match
+		// conditions take precedence only for the requests meeting them, which is intended.
+		unreachable := false
+		for _, other := range patterns {
+			if unreachable || other == pattern || !isValidRoute(other) || c.RouteConfigs[other].Match.Conditions() > 0 ||
+				!c.routePrecedes(other, pattern) || !routesOverlap(pattern, other) {
+				continue
+			}
+
+			switch {
+			case routeCovers(other, pattern):
+				issues = append(issues, Issue{
+					Severity: SeverityWarning,
+					Key:      RouteConfigKey(pattern),
+					Message:  fmt.Sprintf("Unreachable route config: %s covers its requests and takes precedence", other),
+				})
+				unreachable = true
+			case routeCovers(pattern, other):
+				// A more specific pattern overriding part of this one
+			default:
+				issues = append(issues, Issue{
+					Severity: SeverityWarning,
+					Key:      RouteConfigKey(pattern),
+					Message:  fmt.Sprintf("Overlaps with %s, which takes precedence for the requests matching both", other),
+				})
+			}
+		}
+	}
+
+	return issues
+}
+
+// routePrecedes returns whether the route config of pattern a applies instead of the one of b to the requests
+// matching both, see RouteMatcher
+func (c *HTTPConfig) routePrecedes(a, b string) bool {
+	ea, errA := newMatcherEntry(a)
+	eb, errB := newMatcherEntry(b)
+	if errA != nil || errB != nil {
+		return errB != nil && errA == nil
+	}
+	ea.conditions = c.RouteConfigs[a].Match.Conditions()
+	eb.conditions = c.RouteConfigs[b].Match.Conditions()
+
+	return ea.precedes(eb)
+}
+
+func sortedPatterns(routeConfigs map[string]RouteConfig) []string {
+	patterns := make([]string, 0, len(routeConfigs))
+	for pattern := range routeConfigs {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	return patterns
+}
+
+func isValidRoute(route string) bool {
+	_, path := ParseRoute(trimRouteLabel(route))
+	return isValidRoutePattern(path)
+}
+
+// routeCovers returns whether every request matching route b matches route a as well
+func routeCovers(a, b string) bool {
+	methodA, pathA := ParseRoute(trimRouteLabel(a))
+	methodB, pathB := ParseRoute(trimRouteLabel(b))
+	if methodA != "*" && methodA != methodB {
+		return false
+	}
+
+	patternA, _ := parsePathPattern(pathA)
+	patternB, _ := parsePathPattern(pathB)
+	return patternA.covers(patternB)
+}
+
+// routesOverlap returns whether a request can match both routes
+func routesOverlap(a, b string) bool {
+	methodA, pathA := ParseRoute(trimRouteLabel(a))
+	methodB, pathB := ParseRoute(trimRouteLabel(b))
+	if methodA != "*" && methodB != "*" && methodA != methodB {
+		return false
+	}
+
+	patternA, _ := parsePathPattern(pathA)
+	patternB, _ := parsePathPattern(pathB)
+	return patternA.overlaps(patternB)
+}
+
+// covers returns whether every path matching o matches p as well
+func (p pathPattern) covers(o pathPattern) bool {
+	switch p.kind {
+	case pathPrefix:
+		// The paths of o must start with the segments of the prefix
+		return len(o.segments) >= len(p.segments) && segmentsOverlap(p.segments, o.segments[:len(p.segments)], true)
+	case pathSegments:
+		return o.kind != pathPrefix && segmentsOverlap(p.segments, o.literalSegments(), true)
+	}
+
+	return o.kind == pathLiteral && o.raw == p.raw
+}
+
+// overlaps returns whether a path can match both p and o
+func (p pathPattern) overlaps(o pathPattern) bool {
+	if p.covers(o) || o.covers(p) {
+		return true
+	}
+
+	if p.kind == pathSegments && o.kind == pathPrefix {
+		p, o = o, p
+	}
+
+	switch {
+	case p.kind == pathSegments && o.kind == pathSegments:
+		return segmentsOverlap(p.segments, o.segments, false)
+	case p.kind == pathPrefix && o.kind == pathSegments:
+		// A path of o can start with the segments of the prefix
+		return len(o.segments) >= len(p.segments) && segmentsOverlap(p.segments, o.segments[:len(p.segments)], false)
+	case p.kind == pathPrefix && o.kind == pathPrefix:
+		// A path can start with the segments of both prefixes
+		n := len(p.segments)
+		if len(o.segments) < n {
+			n = len(o.segments)
+		}
+		return segmentsOverlap(p.segments[:n], o.segments[:n], false)
+	}
+
+	// A literal path overlaps only with the patterns covering it
+	return false
+}
+
+// literalSegments returns the segments of p, of which the ones of a literal path are all literal
+func (p pathPattern) literalSegments() []patternSegment {
+	if p.kind != pathLiteral {
+		return p.segments
+	}
+
+	segments := make([]patternSegment, 0, len(p.segments))
+	for _, segment := range splitPath(p.raw) {
+		segments = append(segments, patternSegment{kind: segmentLiteral, value: segment})
+	}
+
+	return segments
+}
+
+// segmentsOverlap returns whether a path can match both segment patterns or, when covers is true, whether every path
+// matching b matches a. Two different regexps are assumed to overlap, but not to cover each other.
+func segmentsOverlap(a, b []patternSegment, covers bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !segmentOverlaps(a[i], b[i], covers) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func segmentOverlaps(a, b patternSegment, covers bool) bool {
+	switch {
+	case a.kind == segmentWildcard:
+		return true
+	case b.kind == segmentWildcard:
+		return !covers
+	case a.kind == segmentRegexp && b.kind == segmentRegexp:
+		return !covers || a.expr == b.expr
+	case a.kind == segmentRegexp:
+		return a.re.MatchString(b.value)
+	case b.kind == segmentRegexp:
+		return !covers && b.re.MatchString(a.value)
+	}
+
+	return a.value == b.value
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouteCovers(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"GET:/api/v1/users/*", "GET:/api/v1/users/*/profile", true},
+		{"GET:/api/v1/users/*", "GET:/api/v1/users/42", true},
+		{"GET:/api/v1/users/*", "POST:/api/v1/users/42", false},
+		{"*:/api/v1/users/*", "POST:/api/v1/users/42", true},
+		{"GET:/api/v1/users/*/profile", "GET:/api/v1/users/*", false},
+		{"GET:/api/*/users/*", "GET:/api/v1/users/*", false},
+		{"GET:/api/*/users/*", "GET:/api/v1/users/42", true},
+		{"GET:/api/v1/users/*", "GET:/api/*/users/*", false},
+		{"GET:/api/*", "GET:/api", true},
+		{"GET:/api/*", "GET:/apis", false},
+		{"GET:/api/*", "GET:/apis/*", false},
+		{"GET:/api/v1/*", "GET:/api/v1/*/*", true},
+		{"GET:/*", "GET:/health", true},
+		{"GET:/health", "GET:/health", true},
+		{"GET:/health", "GET:/healthz", false},
+		{"GET:/users/{id}", "GET:/users/{id:[0-9]+}", true},
+		{"GET:/users/{id:[0-9]+}", "GET:/users/42", true},
+		{"GET:/users/{id:[0-9]+}", "GET:/users/me", false},
+		{"GET:/users/{id:[0-9]+}", "GET:/users/{id}", false},
+		{"GET:/static/{path...}", "GET:/static/css/*", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			if got := routeCovers(tt.a, tt.b); got != tt.want {
+				t.Errorf("routeCovers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutesOverlap(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"GET:/api/*/orders", "GET:/api/v1/*", true},
+		{"GET:/api/*/orders", "GET:/api/v1/users/*", false},
+		{"GET:/api/*/orders/*", "GET:/api/v1/*/*", true},
+		{"GET:/api/*/orders/*", "GET:/api/v1/*/items/*", false},
+		{"GET:/api/v1/*", "GET:/api/v2/*", false},
+		{"GET:/api/v1/*", "GET:/api/v1s/*/orders", false},
+		{"GET:/api/v1/*", "POST:/api/*", false},
+		{"*:/api/v1/users/42", "GET:/api/v1/users/*", true},
+		{"GET:/health", "GET:/ready", false},
+		{"GET:/users/{id:[0-9]+}/orders", "GET:/users/me/*", false},
+		{"GET:/api/{v}/*", "GET:/api/v1/users/*", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			if got := routesOverlap(tt.a, tt.b); got != tt.want {
+				t.Errorf("routesOverlap() = %v, want %v", got, tt.want)
+			}
+			if got := routesOverlap(tt.b, tt.a); got != tt.want {
+				t.Errorf("routesOverlap() reversed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPConfig_Lint(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(c *HTTPConfig)
+		want   []Issue
+	}{
+		{
+			name:   "Valid config",
+			config: func(c *HTTPConfig) {},
+			want:   nil,
+		},
+		{
+			name: "Errors of every section and route",
+			config: func(c *HTTPConfig) {
+				c.GlobalConfig.TestProbability = 150
+				c.Capture = Capture{Enabled: true, Format: "xml", Directory: "capture", MaxFileSize: 1}
+				c.RouteConfigs = map[string]RouteConfig{
+					"GET:/a": {TestProbability: 101, BodyCompareMode: "bogus"},
+					"GET:/b": {DedupWindow: -1},
+				}
+			},
+			want: []Issue{
+				{SeverityError, "global_config.test_probability", "invalid test_probability in global_config: 150 must be between 0 and 100"},
+				{SeverityError, "capture", `invalid capture format "xml": must be "jsonl" or "har"`},
+				{SeverityError, "route_configs.GET:/a", "invalid body_compare_mode in route_configs for GET:/a: bogus"},
+				{SeverityError, "route_configs.GET:/a", "invalid test_probability in route_configs for GET:/a: 101 must be between 0 and 100"},
+				{SeverityError, "route_configs.GET:/b", "invalid dedup_window in GET:/b: -1ns must not be negative"},
+			},
+		},
+		{
+			name: "Shadowed and overlapping patterns",
+			config: func(c *HTTPConfig) {
+				c.RouteConfigs = map[string]RouteConfig{
+					"GET:/api/v1/users/*":         {},
+					"GET:/api/v1/users/*/profile": {},
+					"GET:/api/v1/users/42":        {},
+					"GET:/api/*/orders":           {},
+					"GET:/api/v1/*/*":             {},
+					"GET:/api/v2/*":               {},
+					"GET:/api/v3/*":               {},
+					"GET:/api/v3/*/*":             {},
+				}
+			},
+			want: []Issue{
+				{SeverityWarning, "route_configs.GET:/api/v1/*/*", "Overlaps with GET:/api/v1/users/*, which takes precedence for the requests matching both"},
+				{SeverityWarning, "route_configs.GET:/api/v2/*", "Overlaps with GET:/api/*/orders, which takes precedence for the requests matching both"},
+				{SeverityWarning, "route_configs.GET:/api/v3/*", "Overlaps with GET:/api/*/orders, which takes precedence for the requests matching both"},
+				{SeverityWarning, "route_configs.GET:/api/v3/*/*", "Unreachable route config: GET:/api/v3/* covers its requests and takes precedence"},
+			},
+		},
+		{
+			name: "Route configs with match conditions",
+			config: func(c *HTTPConfig) {
+				csv := RouteMatch{Query: []MatchCondition{{Name: "format", Equals: "csv"}}}
+				c.RouteConfigs = map[string]RouteConfig{
+					"GET:/reports/*":         {},
+					"GET:/reports/*#csv":     {Match: csv},
+					"GET:/reports/7#csv":     {Match: csv},
+					"GET:/exports/*":         {},
+					"GET:/exports/*/*#csv":   {Match: csv},
+					"GET:/imports/*#":        {},
+					"GET:/imports/*#invalid": {Match: RouteMatch{Headers: []MatchCondition{{Name: "X-Client"}}}},
+				}
+			},
+			want: []Issue{
+				{SeverityError, "route_configs.GET:/imports/*#", "invalid route pattern in route_configs: GET:/imports/*#"},
+				{SeverityError, "route_configs.GET:/imports/*#invalid", "invalid match in route_configs for GET:/imports/*#invalid: headers[0] X-Client: exactly one of equals, present and regex must be set"},
+				{SeverityWarning, "route_configs.GET:/exports/*/*#csv", "Unreachable route config: GET:/exports/* covers its requests and takes precedence"},
+			},
+		},
+		{
+			name: "Skipped route configs",
+			config: func(c *HTTPConfig) {
+				c.SkipRoutes = []string{"GET:/health", "*:/internal/*"}
+				c.RouteConfigs = map[string]RouteConfig{
+					"GET:/health":          {},
+					"POST:/internal/cache": {},
+					"GET:/api/users":       {},
+				}
+			},
+			want: []Issue{
+				{SeverityWarning, "route_configs.GET:/health", "Unreachable route config: its requests are skipped by GET:/health in skip_routes"},
+				{SeverityWarning, "route_configs.POST:/internal/cache", "Unreachable route config: its requests are skipped by *:/internal/* in skip_routes"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultHTTP
+			tt.config(&c)
+
+			if got := c.Lint(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RouteMatch contains the conditions on a request, besides matching the route pattern, for a route config to apply.
+// Every condition must hold.
+type RouteMatch struct {
+	Host    *MatchCondition  `koanf:"host" json:"host,omitempty"`       // Condition on the host requested by the client, without its port
+	Query   []MatchCondition `koanf:"query" json:"query,omitempty"`     // Conditions on query parameters
+	Headers []MatchCondition `koanf:"headers" json:"headers,omitempty"` // Conditions on request headers
+}
+
+// MatchCondition is a condition on the host, or on the values of a query parameter or header. Exactly one of Equals,
+// Present and Regex is set, and the condition holds when any of the values satisfies it.
+type MatchCondition struct {
+	Name    string `koanf:"name" json:"name,omitempty"`       // Name of the query parameter or header, not set for the host
+	Equals  string `koanf:"equals" json:"equals,omitempty"`   // A value equals it
+	Present bool   `koanf:"present" json:"present,omitempty"` // There is a value, which may be empty
+	Regex   string `koanf:"regex" json:"regex,omitempty"`     // A value matches the regular expression, which is not anchored
+}
+
+// Conditions returns the number of conditions of m
+func (m RouteMatch) Conditions() int {
+	n := len(m.Query) + len(m.Headers)
+	if m.Host != nil {
+		n++
+	}
+
+	return n
+}
+
+func (m RouteMatch) validate() error {
+	if m.Host != nil {
+		if m.Host.Name != "" {
+			return errors.New("host: name must not be set")
+		}
+		if err := m.Host.validate(); err != nil {
+			return fmt.Errorf("host: %w", err)
+		}
+	}
+
+	for _, conditions := range []struct {
+		key        string
+		conditions []MatchCondition
+	}{{"query", m.Query}, {"headers", m.Headers}} {
+		for i, c := range conditions.conditions {
+			if c.Name == "" {
+				return fmt.Errorf("%s[%d]: name is required", conditions.key, i)
+			}
+			if err := c.validate(); err != nil {
+				return fmt.Errorf("%s[%d] %s: %w", conditions.key, i, c.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c MatchCondition) validate() error {
+	set := 0
+	for _, isSet := range []bool{c.Equals != "", c.Present, c.Regex != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("exactly one of equals, present and regex must be set")
+	}
+
+	if c.Regex != "" {
+		if _, err := regexp.Compile(c.Regex); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// requestMatcher evaluates the conditions of a RouteMatch on requests
+type requestMatcher struct {
+	host    *conditionMatcher
+	query   []conditionMatcher
+	headers []conditionMatcher
+}
+
+// conditionMatcher evaluates a MatchCondition on the values of a request
+type conditionMatcher struct {
+	MatchCondition
+	re *regexp.Regexp
+}
+
+// newRequestMatcher compiles the conditions of m. It returns nil when m has no conditions.
+func newRequestMatcher(m RouteMatch) (*requestMatcher, error) {
+	if m.Conditions() == 0 {
+		return nil, nil
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	compile := func(c MatchCondition) conditionMatcher {
+		cm := conditionMatcher{MatchCondition: c}
+		if c.Regex != "" {
+			cm.re = regexp.MustCompile(c.Regex)
+		}
+		return cm
+	}
+
+	rm := &requestMatcher{}
+	if m.Host != nil {
+		// Host names are case-insensitive, and requestHost lower-cases them
+		c := *m.Host
+		c.Equals = normalizeHost(c.Equals)
+		if c.Regex != "" {
+			c.Regex = "(?i)" + c.Regex
+		}
+		host := compile(c)
+		rm.host = &host
+	}
+	for _, c := range m.Query {
+		rm.query = append(rm.query, compile(c))
+	}
+	for _, c := range m.Headers {
+		c.Name = http.CanonicalHeaderKey(c.Name)
+		rm.headers = append(rm.headers, compile(c))
+	}
+
+	return rm, nil
+}
+
+// matches returns whether every condition holds for the request r, which is false without a request
+func (m *requestMatcher) matches(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+
+	if m.host != nil && !m.host.matches([]string{requestHost(r)}) {
+		return false
+	}
+
+	if len(m.query) > 0 {
+		query := r.URL.Query()
+		for _, c := range m.query {
+			if !c.matches(query[c.Name]) {
+				return false
+			}
+		}
+	}
+
+	for _, c := range m.headers {
+		if !c.matches(r.Header.Values(c.Name)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matches returns whether any of the values satisfies the condition
+func (c conditionMatcher) matches(values []string) bool {
+	for _, v := range values {
+		switch {
+		case c.Present:
+			return true
+		case c.re != nil:
+			if c.re.MatchString(v) {
+				return true
+			}
+		case v == c.Equals:
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestHost returns the host requested by the client, without its port, lower-cased and without a trailing dot
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if host == "" && r.URL != nil {
+		host = r.URL.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return normalizeHost(host)
+}
+
+// normalizeHost lower-cases the host and removes the trailing dot of a fully qualified one
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// trimRouteLabel returns the route pattern of a key of route_configs, which may end with a "#label" to tell apart the
+// route configs of the same pattern with different match conditions, e.g. "GET:/api/v1/reports#csv"
+func trimRouteLabel(key string) string {
+	pattern, _, _ := strings.Cut(key, "#")
+	return pattern
+}
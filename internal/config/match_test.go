@@ -0,0 +1,140 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteMatch_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		match   RouteMatch
+		wantErr string
+	}{
+		{"No conditions", RouteMatch{}, ""},
+		{
+			name: "Conditions",
+			match: RouteMatch{
+				Host:    &MatchCondition{Regex: `\.example\.com$`},
+				Query:   []MatchCondition{{Name: "format", Equals: "csv"}},
+				Headers: []MatchCondition{{Name: "X-Client", Present: true}},
+			},
+		},
+		{"Host with a name", RouteMatch{Host: &MatchCondition{Name: "host", Equals: "api.example.com"}}, "host: name must not be set"},
+		{"Host without a condition", RouteMatch{Host: &MatchCondition{}}, "host: exactly one of equals, present and regex must be set"},
+		{"Query without a name", RouteMatch{Query: []MatchCondition{{Equals: "csv"}}}, "query[0]: name is required"},
+		{
+			name:    "Header with two conditions",
+			match:   RouteMatch{Headers: []MatchCondition{{Name: "X-Client", Equals: "web", Regex: "^web"}}},
+			wantErr: "headers[0] X-Client: exactly one of equals, present and regex must be set",
+		},
+		{
+			name:    "Invalid regex",
+			match:   RouteMatch{Headers: []MatchCondition{{Name: "X-Client", Regex: "(web"}}},
+			wantErr: "headers[0] X-Client: invalid regex: error parsing regexp: missing closing ): `(web`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.match.validate()
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestMatcher_matches(t *testing.T) {
+	newRequest := func(target string, header http.Header) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		return r
+	}
+
+	tests := []struct {
+		name    string
+		match   RouteMatch
+		request *http.Request
+		want    bool
+	}{
+		{
+			name:    "Host without its port",
+			match:   RouteMatch{Host: &MatchCondition{Equals: "api.example.com"}},
+			request: newRequest("http://api.example.com:8080/reports", nil),
+			want:    true,
+		},
+		{
+			name:    "Host of another case with a trailing dot",
+			match:   RouteMatch{Host: &MatchCondition{Equals: "API.example.com"}},
+			request: newRequest("http://api.Example.COM.:8080/reports", nil),
+			want:    true,
+		},
+		{
+			name:    "Host regex of another case",
+			match:   RouteMatch{Host: &MatchCondition{Regex: `^beta\.example\.com$`}},
+			request: newRequest("http://Beta.Example.com./reports", nil),
+			want:    true,
+		},
+		{
+			name:    "Other host",
+			match:   RouteMatch{Host: &MatchCondition{Equals: "api.example.com"}},
+			request: newRequest("http://www.example.com/reports", nil),
+		},
+		{
+			name:    "Query parameter of any value",
+			match:   RouteMatch{Query: []MatchCondition{{Name: "format", Equals: "csv"}}},
+			request: newRequest("/reports?format=json&format=csv", nil),
+			want:    true,
+		},
+		{
+			name:    "Present empty query parameter",
+			match:   RouteMatch{Query: []MatchCondition{{Name: "dry_run", Present: true}}},
+			request: newRequest("/reports?dry_run=", nil),
+			want:    true,
+		},
+		{
+			name:    "Missing query parameter",
+			match:   RouteMatch{Query: []MatchCondition{{Name: "dry_run", Present: true}}},
+			request: newRequest("/reports", nil),
+		},
+		{
+			name:    "Header of a non-canonical name",
+			match:   RouteMatch{Headers: []MatchCondition{{Name: "x-client", Regex: "^(web|ios)$"}}},
+			request: newRequest("/reports", http.Header{"X-Client": {"ios"}}),
+			want:    true,
+		},
+		{
+			name:    "Header regex not matching",
+			match:   RouteMatch{Headers: []MatchCondition{{Name: "X-Client", Regex: "^(web|ios)$"}}},
+			request: newRequest("/reports", http.Header{"X-Client": {"android"}}),
+		},
+		{
+			name: "Every condition",
+			match: RouteMatch{
+				Query:   []MatchCondition{{Name: "format", Equals: "csv"}},
+				Headers: []MatchCondition{{Name: "X-Client", Equals: "web"}},
+			},
+			request: newRequest("/reports?format=csv", http.Header{"X-Client": {"ios"}}),
+		},
+		{
+			name:  "Without a request",
+			match: RouteMatch{Query: []MatchCondition{{Name: "format", Present: true}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newRequestMatcher(tt.match)
+			if err != nil {
+				t.Fatalf("newRequestMatcher() error = %v", err)
+			}
+			if got := m.matches(tt.request); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RouteMatcher finds the route pattern which applies to a request route. The patterns are compiled into a tree of
+// their path segments, so a lookup takes time proportional to the length of the path rather than the number of
+// patterns.
+//
+// When several patterns match a route, the one which precedes the others applies:
+//  1. An exact pattern, i.e. the method and path of the route without wildcards
+//  2. The pattern with the most literal segments
+//  3. The pattern with the fewest wildcards, of which "{name:regexp}" parameters are not
+//  4. A pattern of the method before a "*" one
+//  5. The pattern with the most match conditions, which are evaluated on the request after the pattern matched it
+//  6. The pattern which sorts first
+type RouteMatcher struct {
+	root     *matcherNode
+	literals map[string][]*matcherEntry // Patterns without wildcards by path
+	globs    []*matcherEntry            // Patterns without wildcards using the syntax of path.Match, e.g. "/users/[0-9]"
+}
+
+// matcherEntry is a compiled route pattern
+type matcherEntry struct {
+	pattern    string
+	method     string
+	path       pathPattern
+	exact      bool            // Method without wildcards and a literal path
+	literals   int             // Number of literal segments
+	wildcards  int             // Number of "*" and "{name}" segments, including a trailing one
+	match      *requestMatcher // Match conditions, nil without any
+	conditions int             // Number of match conditions
+}
+
+// matcherNode is a path segment of the compiled patterns
+type matcherNode struct {
+	children map[string]*matcherNode // Literal segments
+	wildcard *matcherNode            // "*" and "{name}" segments
+	regexps  []*regexpEdge           // "{name:regexp}" segments
+	ends     []*matcherEntry         // Patterns whose last segment is this one
+	prefixes []*matcherEntry         // Patterns ending with "/*" or "{name...}" after this segment, which match its sub-paths as well
+}
+
+// regexpEdge is a "{name:regexp}" segment of the compiled patterns, shared by the parameters of the same regexp
+type regexpEdge struct {
+	expr string
+	re   *regexp.Regexp
+	node *matcherNode
+}
+
+// NewRouteMatcher compiles the route patterns into a matcher. Invalid patterns never match, they are rejected by
+// ParseHTTP.
+func NewRouteMatcher(patterns []string) *RouteMatcher {
+	return newRouteMatcher(patterns, nil)
+}
+
+// newRouteMatcher compiles the route patterns into a matcher, with the match conditions of the patterns in matches
+func newRouteMatcher(patterns []string, matches map[string]RouteMatch) *RouteMatcher {
+	m := &RouteMatcher{
+		root:     &matcherNode{},
+		literals: make(map[string][]*matcherEntry),
+	}
+
+	for _, pattern := range patterns {
+		e, err := newMatcherEntry(pattern)
+		if err != nil {
+			continue
+		}
+		if e.match, err = newRequestMatcher(matches[pattern]); err != nil {
+			continue
+		}
+		e.conditions = matches[pattern].Conditions()
+		m.add(e)
+	}
+
+	return m
+}
+
+// newMatcherEntry returns the compiled route pattern, without its place in the tree and its match conditions. The
+// pattern may be a key of route_configs ending with a "#label".
+func newMatcherEntry(pattern string) (*matcherEntry, error) {
+	method, p := ParseRoute(trimRouteLabel(pattern))
+	pp, err := parsePathPattern(p)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &matcherEntry{pattern: pattern, method: method, path: pp}
+	if pp.kind == pathLiteral {
+		for _, segment := range splitPath(p) {
+			if !isGlob(segment) {
+				e.literals++
+			}
+		}
+		e.exact = method != "*" && !isGlob(p)
+		return e, nil
+	}
+
+	if pp.kind == pathPrefix {
+		e.wildcards++
+	}
+	for _, segment := range pp.segments {
+		switch segment.kind {
+		case segmentLiteral:
+			e.literals++
+		case segmentWildcard:
+			e.wildcards++
+		}
+	}
+
+	return e, nil
+}
+
+func (m *RouteMatcher) add(e *matcherEntry) {
+	if e.path.kind == pathLiteral {
+		if isGlob(e.path.raw) {
+			m.globs = append(m.globs, e)
+		} else {
+			m.literals[e.path.raw] = append(m.literals[e.path.raw], e)
+		}
+		return
+	}
+
+	n := m.root
+	for _, segment := range e.path.segments {
+		n = n.child(segment)
+	}
+
+	if e.path.kind == pathPrefix {
+		n.prefixes = append(n.prefixes, e)
+	} else {
+		n.ends = append(n.ends, e)
+	}
+}
+
+// child returns the node of the segment below n, adding it when it is missing
+func (n *matcherNode) child(segment patternSegment) *matcherNode {
+	switch segment.kind {
+	case segmentWildcard:
+		if n.wildcard == nil {
+			n.wildcard = &matcherNode{}
+		}
+		return n.wildcard
+	case segmentRegexp:
+		for _, edge := range n.regexps {
+			if edge.expr == segment.expr {
+				return edge.node
+			}
+		}
+		edge := &regexpEdge{expr: segment.expr, re: segment.re, node: &matcherNode{}}
+		n.regexps = append(n.regexps, edge)
+		return edge.node
+	}
+
+	if n.children == nil {
+		n.children = make(map[string]*matcherNode)
+	}
+	child, ok := n.children[segment.value]
+	if !ok {
+		child = &matcherNode{}
+		n.children[segment.value] = child
+	}
+
+	return child
+}
+
+// Match returns the pattern which applies to route, e.g. "GET:/api/users/42", or false when none matches it. The
+// patterns with match conditions never match, see MatchRequest.
+func (m *RouteMatcher) Match(route string) (string, bool) {
+	return m.MatchRequest(route, nil)
+}
+
+// MatchRequest returns the pattern which applies to route like Match, evaluating the match conditions of the patterns
+// matching the route on the request r. r may be nil.
+func (m *RouteMatcher) MatchRequest(route string, r *http.Request) (string, bool) {
+	s := m.match(route, r)
+	if s.best == nil {
+		return "", false
+	}
+
+	return s.best.pattern, true
+}
+
+// MatchParams returns the pattern which applies to route like Match, and the values of its named route parameters
+// by name, e.g. {"id": "42"} of "GET:/api/users/{id}"
+func (m *RouteMatcher) MatchParams(route string) (string, map[string]string, bool) {
+	s := m.match(route, nil)
+	if s.best == nil {
+		return "", nil, false
+	}
+
+	return s.best.pattern, s.best.path.params(s.segments), true
+}
+
+func (m *RouteMatcher) match(route string, r *http.Request) *matchState {
+	method, p := ParseRoute(route)
+	s := &matchState{method: method, segments: splitPath(p), request: r}
+
+	s.consider(m.literals[p])
+	for _, e := range m.globs {
+		if matched, _ := path.Match(e.path.raw, p); matched || e.path.raw == p {
+			s.considerEntry(e)
+		}
+	}
+	m.root.match(s.segments, s)
+
+	return s
+}
+
+// matchState is the pattern which applies to a route among the ones considered so far
+type matchState struct {
+	method   string
+	segments []string
+	request  *http.Request // Request the match conditions are evaluated on, nil when there is none
+	best     *matcherEntry
+}
+
+func (s *matchState) consider(entries []*matcherEntry) {
+	for _, e := range entries {
+		s.considerEntry(e)
+	}
+}
+
+func (s *matchState) considerEntry(e *matcherEntry) {
+	if (e.method == "*" || e.method == s.method) && (s.best == nil || e.precedes(s.best)) &&
+		(e.match == nil || e.match.matches(s.request)) {
+		s.best = e
+	}
+}
+
+// match considers the patterns matching the path segments below n
+func (n *matcherNode) match(segments []string, s *matchState) {
+	s.consider(n.prefixes)
+	if len(segments) == 0 {
+		s.consider(n.ends)
+		return
+	}
+
+	if child, ok := n.children[segments[0]]; ok {
+		child.match(segments[1:], s)
+	}
+	if n.wildcard != nil {
+		n.wildcard.match(segments[1:], s)
+	}
+	for _, edge := range n.regexps {
+		if edge.re.MatchString(segments[0]) {
+			edge.node.match(segments[1:], s)
+		}
+	}
+}
+
+// precedes returns whether e applies instead of o to the routes matching both
+func (e *matcherEntry) precedes(o *matcherEntry) bool {
+	switch {
+	case e.exact != o.exact:
+		return e.exact
+	case e.literals != o.literals:
+		return e.literals > o.literals
+	case e.wildcards != o.wildcards:
+		return e.wildcards < o.wildcards
+	case (e.method == "*") != (o.method == "*"):
+		return e.method != "*"
+	case e.conditions != o.conditions:
+		return e.conditions > o.conditions
+	}
+
+	return e.pattern < o.pattern
+}
+
+// patternMatchers caches the matchers of single route patterns with route parameters, see routeParamsMatcher
+var patternMatchers sync.Map
+
+// routeParamsMatcher returns the matcher of a route pattern with route parameters, which is compiled only once
+func routeParamsMatcher(pattern string) *RouteMatcher {
+	if m, ok := patternMatchers.Load(pattern); ok {
+		return m.(*RouteMatcher)
+	}
+
+	m, _ := patternMatchers.LoadOrStore(pattern, NewRouteMatcher([]string{pattern}))
+	return m.(*RouteMatcher)
+}
+
+// RouteParams returns the values of the named route parameters of pattern in route by name, or nil when the pattern
+// has none or does not match the route
+func RouteParams(pattern, route string) map[string]string {
+	if !hasRouteParams(pattern) {
+		return nil
+	}
+
+	_, params, _ := routeParamsMatcher(pattern).MatchParams(route)
+	return params
+}
+
+// hasRouteParams returns whether the route pattern has "{name}" segments
+func hasRouteParams(pattern string) bool {
+	return strings.Contains(pattern, "{")
+}
+
+// Kinds of path patterns
+const (
+	pathLiteral  = iota // Matches only its path
+	pathPrefix          // Ends with "/*" as the only "*" or with "{name...}", matches its segments and the paths below them
+	pathSegments        // Matches the paths of its number of segments
+)
+
+// pathPattern is a path pattern of the route config syntax
+type pathPattern struct {
+	kind     int
+	raw      string
+	segments []patternSegment // Of a pathPrefix pattern, the ones before its trailing wildcard
+	rest     string           // Name of the "{name...}" parameter of a pathPrefix pattern, empty for "/*"
+}
+
+// Kinds of path pattern segments
+const (
+	segmentLiteral  = iota // Matches only itself
+	segmentWildcard        // "*" or "{name}", matches any segment
+	segmentRegexp          // "{name:regexp}", matches the segments matching the regexp
+)
+
+// patternSegment is a segment of a path pattern
+type patternSegment struct {
+	kind  int
+	value string         // The segment as written
+	name  string         // Name of the route parameter, empty for literals and "*"
+	expr  string         // Regexp of a segmentRegexp
+	re    *regexp.Regexp // Compiled regexp of a segmentRegexp, matching whole segments
+}
+
+// routeParamName is the syntax of the names of route parameters
+var routeParamName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parsePathPattern parses a path pattern, returning an error when its route parameters are invalid
+func parsePathPattern(p string) (pathPattern, error) {
+	pp := pathPattern{raw: p}
+	names := make(map[string]bool)
+	segments := splitPath(p)
+	wildcards := 0
+	for i, s := range segments {
+		segment, rest, err := parsePatternSegment(s)
+		if err != nil {
+			return pathPattern{}, err
+		}
+
+		if segment.name != "" {
+			if names[segment.name] {
+				return pathPattern{}, fmt.Errorf("duplicate route parameter %q", segment.name)
+			}
+			names[segment.name] = true
+		}
+
+		if rest {
+			if i != len(segments)-1 {
+				return pathPattern{}, fmt.Errorf("route parameter %s must be the last segment", s)
+			}
+			pp.kind, pp.rest = pathPrefix, segment.name
+			return pp, nil
+		}
+
+		if s == "*" {
+			wildcards++
+		}
+		pp.segments = append(pp.segments, segment)
+	}
+
+	switch {
+	case strings.HasSuffix(p, "/*") && wildcards == 1:
+		// The trailing "/*" is the only "*" of the pattern
+		pp.kind = pathPrefix
+		pp.segments = pp.segments[:len(pp.segments)-1]
+	case strings.Contains(p, "*") || len(names) > 0:
+		pp.kind = pathSegments
+	default:
+		pp.kind = pathLiteral
+	}
+
+	return pp, nil
+}
+
+// parsePatternSegment parses a segment of a path pattern. rest is true for a "{name...}" parameter.
+func parsePatternSegment(s string) (segment patternSegment, rest bool, err error) {
+	segment.value = s
+	if s == "*" {
+		segment.kind = segmentWildcard
+		return segment, false, nil
+	}
+
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		if strings.ContainsAny(s, "{}") {
+			return segment, false, fmt.Errorf("route parameter %s must be a whole segment", s)
+		}
+		segment.kind = segmentLiteral
+		return segment, false, nil
+	}
+
+	inner := s[1 : len(s)-1]
+	if strings.HasSuffix(inner, "...") {
+		segment.kind, segment.name, rest = segmentWildcard, strings.TrimSuffix(inner, "..."), true
+	} else {
+		segment.kind = segmentWildcard
+		var ok bool
+		segment.name, segment.expr, ok = strings.Cut(inner, ":")
+		if ok {
+			if segment.expr == "" {
+				return segment, false, fmt.Errorf("route parameter %s has an empty regexp", s)
+			}
+			segment.kind = segmentRegexp
+			if segment.re, err = regexp.Compile("^(?:" + segment.expr + ")$"); err != nil {
+				return segment, false, fmt.Errorf("route parameter %s has an invalid regexp: %w", s, err)
+			}
+		}
+	}
+
+	if !routeParamName.MatchString(segment.name) {
+		return segment, false, fmt.Errorf("route parameter %s has an invalid name", s)
+	}
+
+	return segment, rest, nil
+}
+
+// matches returns whether a segment of a request path matches the pattern segment
+func (s patternSegment) matches(segment string) bool {
+	switch s.kind {
+	case segmentWildcard:
+		return true
+	case segmentRegexp:
+		return s.re.MatchString(segment)
+	}
+
+	return s.value == segment
+}
+
+// params returns the named route parameters of the segments of a request path matching the pattern
+func (p pathPattern) params(segments []string) map[string]string {
+	var params map[string]string
+	set := func(name, value string) {
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = value
+	}
+
+	for i, segment := range p.segments {
+		if segment.name != "" && i < len(segments) {
+			set(segment.name, segments[i])
+		}
+	}
+	if p.rest != "" {
+		rest := ""
+		if len(segments) > len(p.segments) {
+			rest = strings.Join(segments[len(p.segments):], "/")
+		}
+		set(p.rest, rest)
+	}
+
+	return params
+}
+
+// splitPath returns the segments of a path, ignoring its leading and trailing slashes
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+
+	return strings.Split(p, "/")
+}
+
+// isGlob returns whether the path uses the syntax of path.Match apart from "*"
+func isGlob(p string) bool {
+	return strings.ContainsAny(p, `?[\`)
+}
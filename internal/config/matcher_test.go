@@ -0,0 +1,244 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRouteMatcher_Match(t *testing.T) {
+	m := NewRouteMatcher([]string{
+		"GET:/api/users",
+		"*:/api/users",
+		"GET:/api/users/*",
+		"GET:/api/users/*/profile",
+		"*:/api/users/*/profile",
+		"GET:/api/*/7/profile",
+		"GET:/api/*/*/profile",
+		"GET:/api/*/orders",
+		"GET:/api/v1/*",
+		"POST:/*",
+		"GET:/files/[0-9]",
+		"*",
+	})
+
+	tests := []struct {
+		name    string
+		route   string
+		want    string
+		matched bool
+	}{
+		{"Exact before method wildcard", "GET:/api/users", "GET:/api/users", true},
+		{"Literal method wildcard", "PUT:/api/users", "*:/api/users", true},
+		{"Literal before trailing wildcard", "POST:/api/users", "*:/api/users", true},
+		{"Trailing wildcard", "GET:/api/users/42", "GET:/api/users/*", true},
+		{"Trailing wildcard sub-path", "GET:/api/users/42/orders/7", "GET:/api/users/*", true},
+		{"Most literal segments", "GET:/api/users/42/profile", "GET:/api/users/*/profile", true},
+		{"Method before method wildcard", "PUT:/api/users/42/profile", "*:/api/users/*/profile", true},
+		{"Fewest wildcards", "GET:/api/v1/42/profile", "GET:/api/v1/*", true},
+		{"Sorted first on a tie", "GET:/api/v1/orders", "GET:/api/*/orders", true},
+		{"Sorted first on a tie of segments", "GET:/api/users/7/profile", "GET:/api/*/7/profile", true},
+		{"Trailing wildcard of its prefix", "GET:/api/v1", "GET:/api/v1/*", true},
+		{"Trailing wildcard of whole segments", "GET:/api/v10/items", "", false},
+		{"Root trailing wildcard", "POST:/", "POST:/*", true},
+		{"Path pattern", "GET:/files/7", "GET:/files/[0-9]", true},
+		{"Single segment wildcard", "DELETE:/health", "*", true},
+		{"No match", "DELETE:/api/users/42", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, matched := m.Match(tt.route)
+			if got != tt.want || matched != tt.matched {
+				t.Errorf("Match(%q) = %q, %v, want %q, %v", tt.route, got, matched, tt.want, tt.matched)
+			}
+		})
+	}
+}
+
+func TestRouteMatcher_MatchParams(t *testing.T) {
+	m := NewRouteMatcher([]string{
+		"GET:/users/me",
+		"GET:/users/{id:[0-9]+}",
+		"GET:/users/{name}",
+		"GET:/users/{id}/orders/{order:[a-f0-9]{8}}",
+		"GET:/files/{name:.+\\.pdf}",
+		"GET:/files/{path...}",
+		"GET:/static/*",
+	})
+
+	tests := []struct {
+		name       string
+		route      string
+		wantRoute  string
+		wantParams map[string]string
+	}{
+		{"Literal before parameters", "GET:/users/me", "GET:/users/me", nil},
+		{"Regexp parameter before named parameter", "GET:/users/42", "GET:/users/{id:[0-9]+}", map[string]string{"id": "42"}},
+		{"Named parameter", "GET:/users/alice", "GET:/users/{name}", map[string]string{"name": "alice"}},
+		{"Parameters", "GET:/users/42/orders/deadbeef", "GET:/users/{id}/orders/{order:[a-f0-9]{8}}", map[string]string{"id": "42", "order": "deadbeef"}},
+		{"Regexp parameter before rest parameter", "GET:/files/report.pdf", "GET:/files/{name:.+\\.pdf}", map[string]string{"name": "report.pdf"}},
+		{"Rest parameter", "GET:/files/2024/report.csv", "GET:/files/{path...}", map[string]string{"path": "2024/report.csv"}},
+		{"Empty rest parameter", "GET:/files", "GET:/files/{path...}", map[string]string{"path": ""}},
+		{"Anonymous wildcard", "GET:/static/main.css", "GET:/static/*", nil},
+		{"No match", "GET:/users/42/orders/7", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, params, _ := m.MatchParams(tt.route)
+			if got != tt.wantRoute || !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("MatchParams(%q) = %q, %v, want %q, %v", tt.route, got, params, tt.wantRoute, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestRouteMatcher_MatchRequest(t *testing.T) {
+	m := newRouteMatcher([]string{
+		"GET:/reports/*",
+		"GET:/reports/*#csv",
+		"GET:/reports/*#web-csv",
+		"GET:/reports/{id:[0-9]+}#internal",
+	}, map[string]RouteMatch{
+		"GET:/reports/*#csv": {Query: []MatchCondition{{Name: "format", Equals: "csv"}}},
+		"GET:/reports/*#web-csv": {
+			Query:   []MatchCondition{{Name: "format", Equals: "csv"}},
+			Headers: []MatchCondition{{Name: "X-Client", Equals: "web"}},
+		},
+		"GET:/reports/{id:[0-9]+}#internal": {Host: &MatchCondition{Regex: `\.internal$`}},
+	})
+
+	tests := []struct {
+		name    string
+		route   string
+		target  string
+		header  http.Header
+		want    string
+		matched bool
+	}{
+		{"Without conditions", "GET:/reports/7", "/reports/7", nil, "GET:/reports/*", true},
+		{"Conditions", "GET:/reports/7", "/reports/7?format=csv", nil, "GET:/reports/*#csv", true},
+		{"Most conditions", "GET:/reports/7", "/reports/7?format=csv", http.Header{"X-Client": {"web"}}, "GET:/reports/*#web-csv", true},
+		{"Failed conditions", "GET:/reports/7", "/reports/7?format=json", http.Header{"X-Client": {"web"}}, "GET:/reports/*", true},
+		{"Path pattern before conditions", "GET:/reports/7", "http://reports.internal/reports/7?format=csv", nil, "GET:/reports/{id:[0-9]+}#internal", true},
+		{"Conditions after the path pattern", "GET:/reports/7/rows", "http://reports.internal/reports/7/rows", nil, "GET:/reports/*", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+
+			got, matched := m.MatchRequest(tt.route, r)
+			if got != tt.want || matched != tt.matched {
+				t.Errorf("MatchRequest(%q) = %q, %v, want %q, %v", tt.route, got, matched, tt.want, tt.matched)
+			}
+		})
+	}
+
+	if got, _ := m.Match("GET:/reports/7"); got != "GET:/reports/*" {
+		t.Errorf("Match() = %q, want the pattern without conditions", got)
+	}
+}
+
+func TestRouteParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		route   string
+		want    map[string]string
+	}{
+		{"Parameters", "GET:/users/{id}/orders/{order}", "GET:/users/42/orders/7", map[string]string{"id": "42", "order": "7"}},
+		{"Without parameters", "GET:/users/*", "GET:/users/42", nil},
+		{"Labelled pattern", "GET:/users/{id}#internal", "GET:/users/42", map[string]string{"id": "42"}},
+		{"Global config", "", "GET:/users/42", nil},
+		{"No match", "GET:/users/{id:[0-9]+}", "GET:/users/me", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RouteParams(tt.pattern, tt.route); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RouteParams(%q, %q) = %v, want %v", tt.pattern, tt.route, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteMatcher_MatchRoute(t *testing.T) {
+	// The matcher matches the same routes as MatchRoute
+	patterns := []string{
+		"GET:/api/users", "GET:/api/users/*", "*:/api/*/v1/*", "GET:/*/*", "POST:/*", "GET:/users/[0-9]*", "*", "GET:",
+		"GET:/users/{id:[0-9]+}", "*:/api/{v}/*", "GET:/api/{path...}",
+	}
+	routes := []string{
+		"GET:/api/users", "GET:/api/users/", "GET:/api/users/42", "GET:/api/usersettings", "PUT:/api/x/v1/y",
+		"GET:/a/b", "GET:/a", "POST:/", "GET:/users/1", "GET:/health", "GET:",
+	}
+
+	for _, pattern := range patterns {
+		m := NewRouteMatcher([]string{pattern})
+		for _, route := range routes {
+			_, matched := m.Match(route)
+			if want := MatchRoute(route, pattern); matched != want {
+				t.Errorf("Match(%q) of %q = %v, MatchRoute() = %v", route, pattern, matched, want)
+			}
+		}
+	}
+}
+
+// benchmarkPatterns returns n route patterns of the given number of segments, half of them with wildcards
+func benchmarkPatterns(n, segments int) []string {
+	patterns := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		parts := make([]string, segments)
+		for j := range parts {
+			parts[j] = fmt.Sprintf("s%d", (i+j)%50)
+		}
+		if i%2 == 1 {
+			parts[i%segments] = "*"
+		}
+		patterns = append(patterns, "GET:/"+strings.Join(parts, "/"))
+	}
+
+	return patterns
+}
+
+// BenchmarkRouteMatcher_Match shows that a lookup takes time proportional to the number of segments of the path,
+// independent of the number of patterns
+func BenchmarkRouteMatcher_Match(b *testing.B) {
+	for _, segments := range []int{2, 8, 32} {
+		for _, n := range []int{10, 100, 1000} {
+			patterns := benchmarkPatterns(n, segments)
+			m := NewRouteMatcher(patterns)
+			route := strings.Replace(patterns[n-1], "*", "42", 1)
+
+			b.Run(fmt.Sprintf("segments=%d/patterns=%d", segments, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					m.Match(route)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkMatchRoute_Scan is the lookup by matching every pattern with MatchRoute, for comparison
+func BenchmarkMatchRoute_Scan(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		patterns := benchmarkPatterns(n, 8)
+		route := strings.Replace(patterns[n-1], "*", "42", 1)
+
+		b.Run(fmt.Sprintf("segments=8/patterns=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, pattern := range patterns {
+					MatchRoute(route, pattern)
+				}
+			}
+		})
+	}
+}
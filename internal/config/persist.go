@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PersistRoutePatch writes the test_probability, skip_headers and skip_json_paths of the patch to route_configs of the
+// config file at path, adding the route when it is missing. The rest of the file, including its comments but not its
+// blank lines, is kept. Pauses are not written, they only last until a restart.
+func PersistRoutePatch(path, pattern string, patch RoutePatch) error {
+	// Replace the target of a symlinked config file, not the symlink
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("error in resolving the config file: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error in reading the config file: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error in reading the config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("error in parsing the config file: %w", err)
+	}
+	if doc.Kind == 0 {
+		// Empty file
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("error in parsing the config file: the document is not a mapping")
+	}
+
+	routeConfigs, err := mappingValue(root, "route_configs")
+	if err != nil {
+		return err
+	}
+	routeConfig, err := mappingValue(routeConfigs, pattern)
+	if err != nil {
+		return err
+	}
+
+	if patch.TestProbability != nil {
+		err = setMappingValue(routeConfig, "test_probability", *patch.TestProbability)
+	}
+	if err == nil && patch.SkipHeaders != nil {
+		err = setMappingValue(routeConfig, "skip_headers", *patch.SkipHeaders)
+	}
+	if err == nil && patch.SkipJSONPaths != nil {
+		err = setMappingValue(routeConfig, "skip_json_paths", *patch.SkipJSONPaths)
+	}
+	if err != nil {
+		return fmt.Errorf("error in changing %s in the config file: %w", pattern, err)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("error in encoding the config file: %w", err)
+	}
+	if err = encoder.Close(); err != nil {
+		return fmt.Errorf("error in encoding the config file: %w", err)
+	}
+
+	return writeFileAtomic(path, buf.Bytes(), info.Mode().Perm())
+}
+
+// mappingValue returns the mapping of key in the mapping node, adding it when it is missing or null
+func mappingValue(node *yaml.Node, key string) (*yaml.Node, error) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != key {
+			continue
+		}
+
+		value := node.Content[i+1]
+		switch {
+		case value.Kind == yaml.MappingNode:
+			return value, nil
+		case value.Kind == yaml.ScalarNode && value.Tag == "!!null":
+			*value = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			return value, nil
+		default:
+			return nil, fmt.Errorf("error in changing the config file: %s is not a mapping", key)
+		}
+	}
+
+	value := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+
+	return value, nil
+}
+
+// setMappingValue replaces the value of key in the mapping node by v, adding it when it is missing. The comments of
+// the replaced value are kept, and lists are written in the flow style of the example config.
+func setMappingValue(node *yaml.Node, key string, v interface{}) error {
+	value := &yaml.Node{}
+	if err := value.Encode(v); err != nil {
+		return err
+	}
+	if value.Kind == yaml.SequenceNode {
+		value.Style = yaml.FlowStyle
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			old := node.Content[i+1]
+			value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+			node.Content[i+1] = value
+			return nil
+		}
+	}
+
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data, so that a reload never reads a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error in writing the config file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error in writing the config file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("error in writing the config file: %w", err)
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("error in writing the config file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error in writing the config file: %w", err)
+	}
+
+	return nil
+}
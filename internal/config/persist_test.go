@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPersistRoutePatch(t *testing.T) {
+	probability := uint64(25)
+
+	tests := []struct {
+		name    string
+		content string
+		pattern string
+		patch   RoutePatch
+		want    []string // Substrings of the written file
+		wantErr string
+	}{
+		{
+			name: "Existing route",
+			content: `# Proksi config
+bind: "0.0.0.0:9090"
+
+route_configs:
+  "GET:/api/users/*":
+    test_probability: 50 # Half of the requests
+    compare_body: "disable"
+`,
+			pattern: "GET:/api/users/*",
+			patch:   RoutePatch{TestProbability: &probability, SkipHeaders: &[]string{"Date"}},
+			want: []string{
+				"# Proksi config",
+				"test_probability: 25 # Half of the requests",
+				`compare_body: "disable"`,
+				"skip_headers: [Date]",
+			},
+		},
+		{
+			name:    "Missing route_configs",
+			content: "bind: \"0.0.0.0:9090\"\n",
+			pattern: "GET:/api/users",
+			patch:   RoutePatch{SkipJSONPaths: &[]string{}},
+			want:    []string{"route_configs:\n  GET:/api/users:\n    skip_json_paths: []"},
+		},
+		{
+			name:    "Empty route_configs",
+			content: "route_configs:\n",
+			pattern: "GET:/api/users",
+			patch:   RoutePatch{TestProbability: &probability, Paused: true},
+			want:    []string{"route_configs:\n  GET:/api/users:\n    test_probability: 25\n"},
+		},
+		{
+			name:    "Invalid route_configs",
+			content: "route_configs: [\"GET:/api/users\"]\n",
+			pattern: "GET:/api/users",
+			patch:   RoutePatch{TestProbability: &probability},
+			wantErr: "route_configs is not a mapping",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o640); err != nil {
+				t.Fatalf("Failed to write the config file: %v", err)
+			}
+
+			err := PersistRoutePatch(path, tt.pattern, tt.patch)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("PersistRoutePatch() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PersistRoutePatch() error = %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read the config file: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("PersistRoutePatch() file = %s, want it to contain %q", data, want)
+				}
+			}
+			if strings.Contains(string(data), "paused") {
+				t.Errorf("PersistRoutePatch() persisted the pause")
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Failed to stat the config file: %v", err)
+			}
+			if info.Mode().Perm() != 0o640 {
+				t.Errorf("PersistRoutePatch() mode = %v, want %v", info.Mode().Perm(), os.FileMode(0o640))
+			}
+
+			// The written file must still be a valid config
+			if _, err = ParseHTTP(path); err != nil {
+				t.Errorf("ParseHTTP() of the written file error = %v", err)
+			}
+		})
+	}
+}
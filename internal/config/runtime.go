@@ -0,0 +1,139 @@
+package config
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// runtimeMu serializes the changes of the route configurations by reloads and by the admin API
+	runtimeMu sync.Mutex
+
+	// source is the config the current route configurations are computed from
+	source *HTTPConfig
+
+	// runtime contains the changes made through the admin API, applied on top of the config file
+	runtime Runtime
+)
+
+// Runtime contains the changes of the route configurations made at runtime. They are applied on top of the config
+// file, so they are kept when it is reloaded.
+type Runtime struct {
+	Paused bool                  `json:"paused"` // Shadowing is paused for every route
+	Routes map[string]RoutePatch `json:"routes"` // Changes of route_configs by route pattern
+}
+
+// RoutePatch contains the changes of a route config. Nil fields keep the value of the config file.
+type RoutePatch struct {
+	Paused          bool      `json:"paused,omitempty"`           // Shadowing is paused for the route
+	TestProbability *uint64   `json:"test_probability,omitempty"` // Replaces test_probability of the route
+	SkipHeaders     *[]string `json:"skip_headers,omitempty"`     // Replaces skip_headers of the route, the global ones still apply
+	SkipJSONPaths   *[]string `json:"skip_json_paths,omitempty"`  // Replaces skip_json_paths of the route, the global ones still apply
+}
+
+// IsEmpty returns whether the patch changes nothing
+func (p RoutePatch) IsEmpty() bool {
+	return !p.Paused && p.TestProbability == nil && p.SkipHeaders == nil && p.SkipJSONPaths == nil
+}
+
+// copyRuntime returns a copy of r whose routes can be changed without changing r
+func copyRuntime(r Runtime) Runtime {
+	routes := make(map[string]RoutePatch, len(r.Routes))
+	for pattern, patch := range r.Routes {
+		routes[pattern] = patch
+	}
+
+	return Runtime{Paused: r.Paused, Routes: routes}
+}
+
+// Compute pre-computes the route configurations of c with the runtime changes r applied. Changes of routes which are
+// not in route_configs of c are ignored.
+func (c *HTTPConfig) Compute(r Runtime) *ComputedRouteConfigs {
+	patched := *c
+	patched.RouteConfigs = make(map[string]RouteConfig, len(c.RouteConfigs)+len(r.Routes))
+	for pattern, routeConfig := range c.RouteConfigs {
+		patched.RouteConfigs[pattern] = routeConfig
+	}
+
+	for pattern, patch := range r.Routes {
+		routeConfig, ok := patched.RouteConfigs[pattern]
+		if !ok {
+			continue
+		}
+		if patch.TestProbability != nil {
+			routeConfig.TestProbability = *patch.TestProbability
+		}
+		if patch.SkipHeaders != nil {
+			routeConfig.SkipHeaders = *patch.SkipHeaders
+		}
+		if patch.SkipJSONPaths != nil {
+			routeConfig.SkipJSONPaths = *patch.SkipJSONPaths
+		}
+		patched.RouteConfigs[pattern] = routeConfig
+	}
+
+	computed := patched.PrecomputeRouteConfigs()
+
+	computed.Global.Paused = r.Paused
+	for pattern, routeConfig := range computed.Routes {
+		routeConfig.Paused = r.Paused || r.Routes[pattern].Paused
+		computed.Routes[pattern] = routeConfig
+	}
+
+	return computed
+}
+
+// Apply computes the route configurations of the config c with the current runtime changes and, when validate
+// accepts them, makes them the current ones. validate may be nil.
+func Apply(c *HTTPConfig, validate func(*ComputedRouteConfigs) error) error {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+
+	computed := c.Compute(runtime)
+	if validate != nil {
+		if err := validate(computed); err != nil {
+			return err
+		}
+	}
+
+	source = c
+	SetComputedConfigs(computed)
+
+	return nil
+}
+
+// UpdateRuntime changes the runtime changes with update and applies them to the config the current route
+// configurations are computed from. Nothing is changed when update or validate fails. validate may be nil.
+func UpdateRuntime(update func(r *Runtime) error, validate func(*ComputedRouteConfigs) error) error {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+
+	if source == nil {
+		return errors.New("no config is applied")
+	}
+
+	next := copyRuntime(runtime)
+	if err := update(&next); err != nil {
+		return err
+	}
+
+	computed := source.Compute(next)
+	if validate != nil {
+		if err := validate(computed); err != nil {
+			return err
+		}
+	}
+
+	runtime = next
+	SetComputedConfigs(computed)
+
+	return nil
+}
+
+// CurrentRuntime returns a copy of the current runtime changes
+func CurrentRuntime() Runtime {
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+
+	return copyRuntime(runtime)
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHTTPConfig_Compute(t *testing.T) {
+	probability := uint64(10)
+	c := &HTTPConfig{
+		GlobalConfig: GlobalConfig{
+			SkipHeaders:     []string{"Date"},
+			TestProbability: 100,
+		},
+		RouteConfigs: map[string]RouteConfig{
+			"GET:/api/users/*": {SkipHeaders: []string{"X-Request-Id"}, TestProbability: 50},
+			"POST:/api/orders": {},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		runtime Runtime
+		want    map[string]ComputedRouteConfig
+	}{
+		{
+			name:    "No changes",
+			runtime: Runtime{},
+			want: map[string]ComputedRouteConfig{
+				"GET:/api/users/*": {SkipHeaders: []string{"Date", "X-Request-Id"}, TestProbability: 50},
+				"POST:/api/orders": {SkipHeaders: []string{"Date"}, TestProbability: 100},
+			},
+		},
+		{
+			name: "Patched route",
+			runtime: Runtime{Routes: map[string]RoutePatch{
+				"GET:/api/users/*": {TestProbability: &probability, SkipHeaders: &[]string{}},
+			}},
+			want: map[string]ComputedRouteConfig{
+				"GET:/api/users/*": {SkipHeaders: []string{"Date"}, TestProbability: 10},
+				"POST:/api/orders": {SkipHeaders: []string{"Date"}, TestProbability: 100},
+			},
+		},
+		{
+			name: "Paused route",
+			runtime: Runtime{Routes: map[string]RoutePatch{
+				"POST:/api/orders": {Paused: true},
+			}},
+			want: map[string]ComputedRouteConfig{
+				"GET:/api/users/*": {SkipHeaders: []string{"Date", "X-Request-Id"}, TestProbability: 50},
+				"POST:/api/orders": {SkipHeaders: []string{"Date"}, TestProbability: 100, Paused: true},
+			},
+		},
+		{
+			name:    "Paused globally",
+			runtime: Runtime{Paused: true},
+			want: map[string]ComputedRouteConfig{
+				"GET:/api/users/*": {SkipHeaders: []string{"Date", "X-Request-Id"}, TestProbability: 50, Paused: true},
+				"POST:/api/orders": {SkipHeaders: []string{"Date"}, TestProbability: 100, Paused: true},
+			},
+		},
+		{
+			name: "Route not in route_configs",
+			runtime: Runtime{Routes: map[string]RoutePatch{
+				"GET:/health": {Paused: true},
+			}},
+			want: map[string]ComputedRouteConfig{
+				"GET:/api/users/*": {SkipHeaders: []string{"Date", "X-Request-Id"}, TestProbability: 50},
+				"POST:/api/orders": {SkipHeaders: []string{"Date"}, TestProbability: 100},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			computed := c.Compute(tt.runtime)
+
+			got := make(map[string]ComputedRouteConfig, len(computed.Routes))
+			for pattern, routeConfig := range computed.Routes {
+				got[pattern] = ComputedRouteConfig{
+					SkipHeaders:     routeConfig.SkipHeaders,
+					TestProbability: routeConfig.TestProbability,
+					Paused:          routeConfig.Paused,
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compute() routes = %+v, want %+v", got, tt.want)
+			}
+			if computed.Global.Paused != tt.runtime.Paused {
+				t.Errorf("Compute() global paused = %v, want %v", computed.Global.Paused, tt.runtime.Paused)
+			}
+		})
+	}
+
+	// The config must not be changed
+	if c.RouteConfigs["GET:/api/users/*"].TestProbability != 50 {
+		t.Errorf("Compute() changed the route configs of the config")
+	}
+}
+
+func TestUpdateRuntime(t *testing.T) {
+	c := &HTTPConfig{
+		GlobalConfig: GlobalConfig{TestProbability: 100},
+		RouteConfigs: map[string]RouteConfig{"GET:/api/users": {}},
+	}
+	if err := Apply(c, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	pause := func(r *Runtime) error {
+		r.Routes["GET:/api/users"] = RoutePatch{Paused: true}
+		return nil
+	}
+
+	// A rejected change is not applied
+	err := UpdateRuntime(pause, func(*ComputedRouteConfigs) error { return errors.New("invalid") })
+	if err == nil {
+		t.Fatalf("UpdateRuntime() error = nil, want an error")
+	}
+	if ComputedConfigs().Routes["GET:/api/users"].Paused || len(CurrentRuntime().Routes) != 0 {
+		t.Fatalf("UpdateRuntime() applied a rejected change")
+	}
+
+	if err = UpdateRuntime(pause, nil); err != nil {
+		t.Fatalf("UpdateRuntime() error = %v", err)
+	}
+	if !ComputedConfigs().Routes["GET:/api/users"].Paused {
+		t.Errorf("UpdateRuntime() did not pause the route")
+	}
+
+	// The changes are kept when the config is applied again, e.g. on reloads
+	if err = Apply(c, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !ComputedConfigs().Routes["GET:/api/users"].Paused {
+		t.Errorf("Apply() dropped the runtime changes")
+	}
+
+	t.Cleanup(func() { runtime = Runtime{} })
+}
@@ -0,0 +1,159 @@
+// Package fingerprint groups the stored differences which are caused by the same regression
+package fingerprint
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snapp-incubator/proksi/internal/jsonpath"
+	"github.com/snapp-incubator/proksi/internal/storage"
+)
+
+// MaxFingerprints bounds the number of fingerprints kept in memory. When it is reached, the least recently seen
+// fingerprint is forgotten.
+const MaxFingerprints = 10000
+
+// Of returns the fingerprint of a record, computed from the route, which is the route pattern of the request or
+// "global" for requests without a route config, and the comparison types, different header names and differing JSON paths of the record, in which array
+// indexes are replaced by "#". Records of different requests hitting the same regression have the same fingerprint,
+// whatever the differing values are.
+func Of(route string, l storage.Log) string {
+	types := append([]string{}, l.ComparisonTypes...)
+	sort.Strings(types)
+
+	headers := make([]string, len(l.DifferentHeaders))
+	for i, header := range l.DifferentHeaders {
+		headers[i] = http.CanonicalHeaderKey(header)
+	}
+	sort.Strings(headers)
+
+	paths := make([]string, 0, len(l.BodyDiff))
+	seen := make(map[string]bool, len(l.BodyDiff))
+	for _, diff := range l.BodyDiff {
+		path := NormalizePath(diff.Path)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, part := range []string{route, strings.Join(types, ","), strings.Join(headers, ","), strings.Join(paths, ",")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// NormalizePath replaces the array indexes of a path by "#", e.g. "items.2.price" becomes "items.#.price"
+func NormalizePath(path string) string {
+	segments := jsonpath.Split(path)
+	for i, segment := range segments {
+		if _, err := strconv.Atoi(segment); err == nil {
+			segments[i] = "#"
+		}
+	}
+
+	return jsonpath.Format(segments)
+}
+
+// Stats are the occurrences of a fingerprint since it was first seen
+type Stats struct {
+	Fingerprint string    `json:"fingerprint"`
+	Route       string    `json:"route"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Count       uint64    `json:"count"`
+
+	windowStart time.Time
+	windowCount uint64
+}
+
+// Tracker keeps the stats of the fingerprints in memory
+type Tracker struct {
+	mu    sync.Mutex
+	stats map[string]*list.Element
+	// recent orders the stats from the most to the least recently seen
+	recent *list.List
+	max    int
+}
+
+// NewTracker creates a Tracker keeping at most max fingerprints
+func NewTracker(max int) *Tracker {
+	return &Tracker{stats: make(map[string]*list.Element), recent: list.New(), max: max}
+}
+
+// Observe records an occurrence of the fingerprint at now and returns its stats. store is false when limit
+// occurrences were already seen in the current window of the fingerprint, which starts at the first occurrence after
+// the previous window ended. A limit of 0 stores every occurrence.
+func (t *Tracker) Observe(fingerprint, route string, now time.Time, limit uint64, window time.Duration) (stats Stats, store bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.stats[fingerprint]
+	if ok {
+		t.recent.MoveToFront(e)
+	} else {
+		if len(t.stats) >= t.max {
+			t.evict()
+		}
+		e = t.recent.PushFront(&Stats{Fingerprint: fingerprint, Route: route, FirstSeen: now})
+		t.stats[fingerprint] = e
+	}
+	s := e.Value.(*Stats)
+
+	s.LastSeen = now
+	s.Count++
+
+	if s.windowStart.IsZero() || now.Sub(s.windowStart) >= window {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	s.windowCount++
+
+	return *s, limit == 0 || s.windowCount <= limit
+}
+
+// evict forgets the least recently seen fingerprint
+func (t *Tracker) evict() {
+	if oldest := t.recent.Back(); oldest != nil {
+		t.recent.Remove(oldest)
+		delete(t.stats, oldest.Value.(*Stats).Fingerprint)
+	}
+}
+
+// Len returns the number of fingerprints kept in memory
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.stats)
+}
+
+// Snapshot returns the stats of the fingerprints, most frequent first
+func (t *Tracker) Snapshot() []Stats {
+	t.mu.Lock()
+	snapshot := make([]Stats, 0, len(t.stats))
+	for e := t.recent.Front(); e != nil; e = e.Next() {
+		snapshot = append(snapshot, *e.Value.(*Stats))
+	}
+	t.mu.Unlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Count != snapshot[j].Count {
+			return snapshot[i].Count > snapshot[j].Count
+		}
+		return snapshot[i].Fingerprint < snapshot[j].Fingerprint
+	})
+
+	return snapshot
+}
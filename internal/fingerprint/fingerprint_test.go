@@ -0,0 +1,192 @@
+package fingerprint
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/snapp-incubator/proksi/internal/storage"
+)
+
+func TestOf(t *testing.T) {
+	base := storage.Log{
+		ComparisonTypes:  []string{"header_diff", "body_diff"},
+		DifferentHeaders: []string{"X-Version", "cache-control"},
+		BodyDiff: []storage.BodyDiff{
+			{Path: "items.2.price", Kind: storage.BodyDiffChanged, Main: "10", Test: "11"},
+			{Path: "total", Kind: storage.BodyDiffChanged, Main: "42", Test: "43"},
+		},
+	}
+	fingerprint := Of("GET:/api/orders/*", base)
+
+	tests := []struct {
+		name  string
+		route string
+		log   storage.Log
+		same  bool
+	}{
+		{
+			name:  "Different values, indexes and order",
+			route: "GET:/api/orders/*",
+			log: storage.Log{
+				ComparisonTypes:  []string{"body_diff", "header_diff"},
+				DifferentHeaders: []string{"Cache-Control", "X-Version"},
+				BodyDiff: []storage.BodyDiff{
+					{Path: "total", Kind: storage.BodyDiffChanged, Main: "7", Test: "8"},
+					{Path: "items.0.price", Kind: storage.BodyDiffChanged, Main: "1", Test: "2"},
+					{Path: "items.5.price", Kind: storage.BodyDiffChanged, Main: "3", Test: "4"},
+				},
+			},
+			same: true,
+		},
+		{
+			name:  "Different route",
+			route: "GET:/api/users/*",
+			log:   base,
+			same:  false,
+		},
+		{
+			name:  "Different comparison types",
+			route: "GET:/api/orders/*",
+			log: storage.Log{
+				ComparisonTypes:  []string{"header_diff", "body_diff", "latency_diff"},
+				DifferentHeaders: base.DifferentHeaders,
+				BodyDiff:         base.BodyDiff,
+			},
+			same: false,
+		},
+		{
+			name:  "Different header names",
+			route: "GET:/api/orders/*",
+			log: storage.Log{
+				ComparisonTypes:  base.ComparisonTypes,
+				DifferentHeaders: []string{"X-Version"},
+				BodyDiff:         base.BodyDiff,
+			},
+			same: false,
+		},
+		{
+			name:  "Different paths",
+			route: "GET:/api/orders/*",
+			log: storage.Log{
+				ComparisonTypes:  base.ComparisonTypes,
+				DifferentHeaders: base.DifferentHeaders,
+				BodyDiff:         []storage.BodyDiff{{Path: "items.2.name", Kind: storage.BodyDiffChanged}},
+			},
+			same: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Of(tt.route, tt.log); (got == fingerprint) != tt.same {
+				t.Errorf("Of() = %q, base fingerprint %q, want same = %v", got, fingerprint, tt.same)
+			}
+		})
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"items.2.price", "items.#.price"},
+		{"0.1", "#.#"},
+		{"meta\\.version", "meta\\.version"},
+		{"user.v2", "user.v2"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := NormalizePath(tt.path); got != tt.expected {
+				t.Errorf("NormalizePath(%q) = %q, want %q", tt.path, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTracker_Observe(t *testing.T) {
+	tracker := NewTracker(MaxFingerprints)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	observations := []struct {
+		offset        time.Duration
+		expectedCount uint64
+		expectedStore bool
+	}{
+		{0, 1, true},
+		{time.Second, 2, true},
+		{2 * time.Second, 3, false},     // Limit reached
+		{59 * time.Second, 4, false},    // Same window
+		{60 * time.Second, 5, true},     // New window
+		{61 * time.Second, 6, true},     // Second of the new window
+		{121 * time.Second, 7, true},    // New window
+		{121*time.Second + 1, 8, true},  // Second of the window
+		{121*time.Second + 2, 9, false}, // Limit reached
+	}
+
+	for i, o := range observations {
+		stats, store := tracker.Observe("abc", "GET:/api", start.Add(o.offset), 2, time.Minute)
+		if stats.Count != o.expectedCount || store != o.expectedStore {
+			t.Errorf("Observation %d: got count %d, store %v, want count %d, store %v", i, stats.Count, store, o.expectedCount, o.expectedStore)
+		}
+	}
+
+	stats := tracker.Snapshot()
+	if len(stats) != 1 {
+		t.Fatalf("Snapshot() returned %d fingerprints, want 1", len(stats))
+	}
+	if !stats[0].FirstSeen.Equal(start) || !stats[0].LastSeen.Equal(start.Add(121*time.Second+2)) {
+		t.Errorf("Snapshot() first seen %s, last seen %s", stats[0].FirstSeen, stats[0].LastSeen)
+	}
+}
+
+func TestTracker_ObserveWithoutLimit(t *testing.T) {
+	tracker := NewTracker(MaxFingerprints)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		if _, store := tracker.Observe("abc", "GET:/api", now, 0, time.Minute); !store {
+			t.Errorf("Observation %d is not stored without a limit", i)
+		}
+	}
+}
+
+func TestTracker_Evict(t *testing.T) {
+	tracker := NewTracker(2)
+	now := time.Now()
+
+	tracker.Observe("a", "GET:/a", now, 0, time.Minute)
+	tracker.Observe("b", "GET:/b", now.Add(time.Second), 0, time.Minute)
+	tracker.Observe("a", "GET:/a", now.Add(2*time.Second), 0, time.Minute)
+	tracker.Observe("c", "GET:/c", now.Add(3*time.Second), 0, time.Minute)
+
+	if tracker.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", tracker.Len())
+	}
+
+	stats := tracker.Snapshot()
+	if stats[0].Fingerprint != "a" || stats[1].Fingerprint != "c" {
+		t.Errorf("Snapshot() = %+v, want a and c, the least recently seen b evicted", stats)
+	}
+}
+
+func TestTracker_EvictAtCapacity(t *testing.T) {
+	tracker := NewTracker(100)
+	now := time.Now()
+
+	for i := 0; i < 1000; i++ {
+		tracker.Observe(strconv.Itoa(i), "GET:/api", now.Add(time.Duration(i)*time.Second), 0, time.Minute)
+	}
+
+	if tracker.Len() != 100 {
+		t.Fatalf("Len() = %d, want 100", tracker.Len())
+	}
+	for _, s := range tracker.Snapshot() {
+		if i, _ := strconv.Atoi(s.Fingerprint); i < 900 {
+			t.Errorf("Fingerprint %s is kept, want only the 100 most recently seen", s.Fingerprint)
+		}
+	}
+}
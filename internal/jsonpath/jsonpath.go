@@ -0,0 +1,115 @@
+// Package jsonpath implements the paths of the skip_json_paths syntax: keys and array indexes separated by ".", where
+// "*" matches any key, "#" any array index, and "\" escapes the next character, e.g. "items.#.price" or "meta\.version".
+package jsonpath
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Split splits a path into its unescaped segments
+func Split(path string) []string {
+	steps := ParsePattern(path)
+	if steps == nil {
+		return nil
+	}
+
+	segments := make([]string, len(steps))
+	for i, step := range steps {
+		segments[i] = step.Key
+	}
+
+	return segments
+}
+
+// Step is a segment of a path pattern
+type Step struct {
+	Key string
+	// Wildcard is "*" or "#" for an unescaped "*" or "#" segment, which matches any key or array index, and empty
+	// for the others, which match Key. An escaped "\*" is the "*" key.
+	Wildcard string
+}
+
+// ParsePattern splits a path pattern into its steps
+func ParsePattern(path string) []Step {
+	if path == "" {
+		return nil
+	}
+
+	var steps []Step
+	var segment strings.Builder
+	escaped := false
+	appendStep := func() {
+		step := Step{Key: segment.String()}
+		if !escaped && (step.Key == "*" || step.Key == "#") {
+			step.Wildcard = step.Key
+		}
+		steps = append(steps, step)
+		segment.Reset()
+		escaped = false
+	}
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path):
+			i++
+			segment.WriteByte(path[i])
+			escaped = true
+		case path[i] == '.':
+			appendStep()
+		default:
+			segment.WriteByte(path[i])
+		}
+	}
+	appendStep()
+
+	return steps
+}
+
+// Format formats the segments as a path
+func Format(segments []string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = EscapeKey(segment)
+	}
+
+	return strings.Join(escaped, ".")
+}
+
+// EscapeKey escapes the characters having special meaning in a path
+func EscapeKey(key string) string {
+	return strings.NewReplacer(`\`, `\\`, ".", `\.`, "*", `\*`, "?", `\?`).Replace(key)
+}
+
+// Append returns a new slice of segments, so that the siblings do not share the backing array
+func Append(segments []string, segment string) []string {
+	return append(segments[:len(segments):len(segments)], segment)
+}
+
+// MatchPrefix checks whether the path pattern matches the beginning of the path given by segments. An unescaped "*"
+// matches any segment and an unescaped "#" any array index.
+func MatchPrefix(pattern []Step, segments []string) bool {
+	if len(pattern) > len(segments) {
+		return false
+	}
+
+	for i, step := range pattern {
+		switch step.Wildcard {
+		case "*":
+		case "#":
+			if _, err := strconv.Atoi(segments[i]); err != nil {
+				return false
+			}
+		default:
+			if step.Key != segments[i] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Match checks whether the path pattern matches exactly the path given by segments
+func Match(pattern []Step, segments []string) bool {
+	return len(pattern) == len(segments) && MatchPrefix(pattern, segments)
+}
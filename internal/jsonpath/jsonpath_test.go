@@ -0,0 +1,69 @@
+package jsonpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{name: "Empty", path: "", want: nil},
+		{name: "Keys and indexes", path: "items.2.price", want: []string{"items", "2", "price"}},
+		{name: "Escaped dot", path: `meta\.version`, want: []string{"meta.version"}},
+		{name: "Escaped wildcard", path: `labels.\*`, want: []string{"labels", "*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Split(tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, segments := range [][]string{{"items", "2", "price"}, {"meta.version"}, {"labels", "*"}, {`a\b`, "?"}} {
+		if got := Split(Format(segments)); !reflect.DeepEqual(got, segments) {
+			t.Errorf("Split(Format(%q)) = %q", segments, got)
+		}
+	}
+}
+
+func TestMatchPrefix(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		path      []string
+		want      bool
+		wantExact bool
+	}{
+		{name: "Same path", pattern: "items.price", path: []string{"items", "price"}, want: true, wantExact: true},
+		{name: "Prefix", pattern: "items", path: []string{"items", "price"}, want: true},
+		{name: "Longer pattern", pattern: "items.price.amount", path: []string{"items", "price"}},
+		{name: "Different key", pattern: "items.cost", path: []string{"items", "price"}},
+		{name: "Any key", pattern: "*.price", path: []string{"items", "price"}, want: true, wantExact: true},
+		{name: "Any index", pattern: "items.#", path: []string{"items", "2"}, want: true, wantExact: true},
+		{name: "Any index of a key", pattern: "items.#", path: []string{"items", "price"}},
+		{name: "Escaped wildcard key", pattern: `labels.\*`, path: []string{"labels", "*"}, want: true, wantExact: true},
+		{name: "Escaped wildcard other key", pattern: `labels.\*`, path: []string{"labels", "env"}},
+		{name: "Escaped index wildcard", pattern: `items.\#`, path: []string{"items", "2"}},
+		{name: "Escaped wildcard in a key", pattern: `a\*b`, path: []string{"a*b"}, want: true, wantExact: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern := ParsePattern(tt.pattern)
+			if got := MatchPrefix(pattern, tt.path); got != tt.want {
+				t.Errorf("MatchPrefix(%q, %q) = %t, want %t", tt.pattern, tt.path, got, tt.want)
+			}
+			if got := Match(pattern, tt.path); got != tt.wantExact {
+				t.Errorf("Match(%q, %q) = %t, want %t", tt.pattern, tt.path, got, tt.wantExact)
+			}
+		})
+	}
+}
@@ -33,6 +33,9 @@ func main() {
 // 1ms to 10s
 var buckets = []float64{0.001, 0.002, 0.005, 0.01, 0.1, 1.0, 10.0}
 
+// Test upstream duration relative to the main upstream one, from 4x faster to 10x slower
+var latencyRatioBuckets = []float64{0.25, 0.5, 0.8, 1.0, 1.25, 1.5, 2.0, 3.0, 5.0, 10.0}
+
 var (
 	HTTPReqCounter = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "proksi",
@@ -76,12 +79,65 @@ var (
 		Name:      "status_2xx_vs_non2xx_count",
 		Help:      "Counter for cases where main upstream returns 2xx but test upstream returns non-2xx",
 	})
+
+	LatencyRatio = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "proksi",
+		Subsystem: "http",
+		Name:      "latency_ratio",
+		Help:      "Ratio of the test upstream duration to the main upstream duration per route pattern",
+		Buckets:   latencyRatioBuckets,
+	}, []string{"route"})
+
+	DedupSkipCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "proksi",
+		Subsystem: "http",
+		Name:      "dedup_skips",
+		Help:      "Counter for records not stored because dedup_limit was reached for their fingerprint per route pattern",
+	}, []string{"route"})
+
+	Fingerprints = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "proksi",
+		Subsystem: "http",
+		Name:      "fingerprints",
+		Help:      "Number of difference fingerprints kept in memory",
+	})
+
+	TrafficCaptureCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "proksi",
+		Subsystem: "http",
+		Name:      "traffic_capture_count",
+		Help:      "Counter for sampled requests of the traffic capture by result: captured, too_large or dropped",
+	}, []string{"result"})
+
+	ConfigReloadCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "proksi",
+		Subsystem: "http",
+		Name:      "config_reload_count",
+		Help:      "Counter for reloads of the route configurations by trigger (file or signal) and result (success or failure)",
+	}, []string{"trigger", "result"})
+
+	ConfigReloadTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "proksi",
+		Subsystem: "http",
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Unix time of the last successful load of the route configurations",
+	})
+
+	CaptureLimitExceededCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "proksi",
+		Subsystem: "http",
+		Name:      "capture_limit_exceeded_count",
+		Help:      "Counter for comparisons skipped because a body could not be captured within max_capture_size",
+	}, []string{"body"})
 )
 
-// InitializeHTTP initialize the metrics
-func InitializeHTTP(bind string) {
+// InitializeHTTP initialize the metrics, handlers are served besides /metrics
+func InitializeHTTP(bind string, handlers map[string]http.Handler) {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	for pattern, handler := range handlers {
+		mux.Handle(pattern, handler)
+	}
 
 	srv := http.Server{
 		Addr:    bind,
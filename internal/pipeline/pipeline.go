@@ -0,0 +1,449 @@
+// Package pipeline compares the responses of the main and test upstreams to a request and stores the differences. It is
+// shared by the proxy, which compares live traffic, and the replay command, which compares captured traffic.
+package pipeline
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/snapp-incubator/proksi/internal/comparator"
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/fingerprint"
+	"github.com/snapp-incubator/proksi/internal/logging"
+	"github.com/snapp-incubator/proksi/internal/metrics"
+	"github.com/snapp-incubator/proksi/internal/redaction"
+	"github.com/snapp-incubator/proksi/internal/storage"
+	"github.com/snapp-incubator/proksi/internal/upstream"
+)
+
+// Response is an upstream response as captured for the comparison
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte // nil when the body comparison mode does not need the body
+	BodySize   int64
+	BodyDigest []byte        // nil unless the body comparison mode is hash
+	Duration   time.Duration // Time until the response headers
+}
+
+// NewResponse returns the Response of a completely captured body
+func NewResponse(statusCode int, header http.Header, body []byte, duration time.Duration) Response {
+	digest := sha256.Sum256(body)
+	return Response{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       body,
+		BodySize:   int64(len(body)),
+		BodyDigest: digest[:],
+		Duration:   duration,
+	}
+}
+
+// ReadResponse reads the body of an upstream response, keeping what the body comparison mode needs. ok is false when
+// the body must be kept but exceeds limit bytes.
+func ReadResponse(res *http.Response, duration time.Duration, bodyComparison string, limit int64) (r Response, ok bool, err error) {
+	var capture *upstream.CaptureReader
+	switch bodyComparison {
+	case config.BodyCompareIgnore, config.BodyCompareStatusOnly:
+		capture = upstream.NewSizeReader(res.Body)
+	case config.BodyCompareLengthOnly, config.BodyCompareHash:
+		capture = upstream.NewDigestReader(res.Body)
+	default:
+		capture = upstream.NewCaptureReader(res.Body, limit)
+	}
+
+	if _, err = io.Copy(io.Discard, capture); err != nil {
+		return Response{}, false, err
+	}
+
+	r = Response{StatusCode: res.StatusCode, Header: res.Header, Duration: duration}
+	r.Body, ok = capture.Captured()
+	if !ok && capture.Keeps() {
+		return r, false, nil
+	}
+
+	r.BodySize, r.BodyDigest, _ = capture.Digest()
+	return r, true, nil
+}
+
+// Comparison is a request sent to both upstreams and their responses
+type Comparison struct {
+	Request     *http.Request // Request of the client, its URL is relative to the upstreams
+	RequestBody []byte
+	Route       string // Formatted route (METHOD:/path)
+	RouteConfig config.ComputedRouteConfig
+	Main        Response
+	Test        Response
+}
+
+func (c *Comparison) loggingFields() []zap.Field {
+	return []zap.Field{
+		zap.String("method", c.Request.Method),
+		zap.String("url", c.Request.URL.String()),
+		zap.String("route", c.Route),
+		zap.Int("main_service_status_code", c.Main.StatusCode),
+		zap.Int("test_service_status_code", c.Test.StatusCode),
+	}
+}
+
+func (c *Comparison) loggingFieldsWithError(err error) []zap.Field {
+	return []zap.Field{
+		zap.String("method", c.Request.Method),
+		zap.String("url", c.Request.URL.String()),
+		zap.String("route", c.Route),
+		zap.Error(err),
+	}
+}
+
+// MetricsRoute returns the label of the route in the per-route metrics, which is the route pattern of its route config
+// to keep the cardinality bounded
+func (c *Comparison) MetricsRoute() string {
+	if c.RouteConfig.Pattern == "" {
+		return "global"
+	}
+
+	return c.RouteConfig.Pattern
+}
+
+// Compare evaluates every enabled dimension of the responses and returns the record holding all their differences, nil
+// when the responses are equivalent
+func Compare(c *Comparison) *storage.Log {
+	bodyComparison := c.RouteConfig.BodyComparison()
+
+	// Every enabled dimension is evaluated, so that a single record holds all the differences of the responses
+	var comparisonTypes, differentHeaders []string
+
+	if !c.RouteConfig.StatusEquivalent(c.Main.StatusCode, c.Test.StatusCode) {
+		logging.L.Warn("Different status code from services", c.loggingFields()...)
+		metrics.ComparisonResults.WithLabelValues("status_diff").Inc()
+		comparisonTypes = append(comparisonTypes, "status_diff")
+
+		// Track when main upstream returns 2xx but test upstream returns non-2xx
+		if isStatus2xx(c.Main.StatusCode) && !isStatus2xx(c.Test.StatusCode) {
+			metrics.StatusCode2xxVsNon2xxCounter.Inc()
+		}
+	}
+
+	mainResContentType := c.Main.Header.Get("content-type")
+	testResContentType := c.Test.Header.Get("content-type")
+	sameContentType := comparator.MediaType(mainResContentType) == comparator.MediaType(testResContentType)
+	if bodyComparison != config.BodyCompareStatusOnly && !sameContentType {
+		logging.L.Warn("Different content types from services", append(c.loggingFields(),
+			zap.String("main_service_content_type", mainResContentType),
+			zap.String("test_service_content_type", testResContentType),
+		)...)
+		metrics.ComparisonResults.WithLabelValues("content_type_diff").Inc()
+		comparisonTypes = append(comparisonTypes, "content_type_diff")
+		differentHeaders = append(differentHeaders, "Content-Type")
+	}
+
+	if c.RouteConfig.CompareHeaders && bodyComparison != config.BodyCompareStatusOnly {
+		headers := compareHeaders(c.RouteConfig.SkipHeaders, c.Main.Header, c.Test.Header)
+		if !sameContentType {
+			// Already reported by the content type comparison
+			headers = withoutHeader(headers, "Content-Type")
+		}
+		if len(headers) > 0 {
+			logging.L.Warn("Different response headers from services", c.loggingFields()...)
+			metrics.ComparisonResults.WithLabelValues("header_diff").Inc()
+			comparisonTypes = append(comparisonTypes, "header_diff")
+			differentHeaders = append(differentHeaders, headers...)
+		}
+	}
+
+	if c.Main.Duration > 0 {
+		metrics.LatencyRatio.WithLabelValues(c.MetricsRoute()).Observe(float64(c.Test.Duration) / float64(c.Main.Duration))
+	}
+
+	exchange := &comparator.Exchange{
+		Request:     c.Request,
+		RequestBody: c.RequestBody,
+		Route:       c.Route,
+		RouteConfig: c.RouteConfig,
+		Main:        comparator.Response{StatusCode: c.Main.StatusCode, Header: c.Main.Header, Body: c.Main.Body, Duration: c.Main.Duration},
+		Test:        comparator.Response{StatusCode: c.Test.StatusCode, Header: c.Test.Header, Body: c.Test.Body, Duration: c.Test.Duration},
+	}
+
+	var bodyResult comparator.Result
+	switch bodyComparison {
+	case config.BodyCompareIgnore, config.BodyCompareStatusOnly:
+		bodyResult.Equal = true
+	case config.BodyCompareLengthOnly:
+		bodyResult.Equal = c.Main.BodySize == c.Test.BodySize
+	case config.BodyCompareHash:
+		bodyResult.Equal = bytes.Equal(c.Main.BodyDigest, c.Test.BodyDigest)
+	default:
+		// Bodies of different content types cannot be compared structurally, unless the route forces a comparator
+		var cmp comparator.Comparator = comparator.BodyComparator(comparator.ExactBytesEqual)
+		var err error
+		if sameContentType || c.RouteConfig.Comparator != "" {
+			_, cmp, err = comparator.Select(c.RouteConfig, mainResContentType)
+		}
+		if err == nil {
+			bodyResult, err = cmp.Compare(exchange)
+		}
+		if err != nil {
+			// e.g. an error page instead of JSON, the bodies are compared byte by byte instead
+			logging.L.Warn("error in response equality check, comparing the bodies exactly", c.loggingFieldsWithError(err)...)
+			bodyResult, _ = comparator.ExactBytesEqual(c.Main.Body, c.Test.Body, c.RouteConfig)
+		}
+	}
+
+	if !bodyResult.Equal {
+		comparisonType := bodyResult.Type
+		if comparisonType == "" {
+			comparisonType = "body_diff"
+		}
+
+		logging.L.Warn("NOT equal body response", append(c.loggingFields(),
+			zap.String("comparison_type", comparisonType),
+		)...)
+		metrics.ComparisonResults.WithLabelValues(comparisonType).Inc()
+		comparisonTypes = append(comparisonTypes, comparisonType)
+	}
+
+	if c.RouteConfig.LatencyExceeded(c.Main.Duration, c.Test.Duration) {
+		logging.L.Warn("Test upstream is slower than the latency thresholds", append(c.loggingFields(),
+			zap.Duration("main_service_duration", c.Main.Duration),
+			zap.Duration("test_service_duration", c.Test.Duration),
+		)...)
+		metrics.ComparisonResults.WithLabelValues("latency_diff").Inc()
+		comparisonTypes = append(comparisonTypes, "latency_diff")
+	}
+
+	failedAssertions := comparator.FailedAssertions(exchange)
+	if len(failedAssertions) > 0 {
+		logging.L.Warn("Failed assertions", append(c.loggingFields(),
+			zap.Strings("failed_assertions", failedAssertions),
+		)...)
+		metrics.ComparisonResults.WithLabelValues("assertion_failed").Inc()
+		comparisonTypes = append(comparisonTypes, "assertion_failed")
+	}
+
+	if len(comparisonTypes) == 0 {
+		logging.L.Info("Equal response", c.loggingFields()...)
+		metrics.ComparisonResults.WithLabelValues("identical").Inc()
+		return nil
+	}
+
+	l := &storage.Log{
+		Timestamp:              time.Now(),
+		URL:                    c.Request.URL.String(),
+		Host:                   c.Request.Host,
+		Method:                 c.Request.Method,
+		Route:                  c.Route,
+		RouteTemplate:          c.RouteConfig.Pattern,
+		RouteParams:            config.RouteParams(c.RouteConfig.Pattern, c.Route),
+		Headers:                c.Request.Header,
+		RequestBodySize:        len(c.RequestBody),
+		MainUpstreamStatusCode: c.Main.StatusCode,
+		TestUpstreamStatusCode: c.Test.StatusCode,
+		MainUpstreamDurationMs: durationMs(c.Main.Duration),
+		TestUpstreamDurationMs: durationMs(c.Test.Duration),
+		ComparisonType:         comparisonTypes[0],
+		ComparisonTypes:        comparisonTypes,
+		DifferentHeaders:       differentHeaders,
+		BodyDiff:               bodyResult.Diff,
+		FailedAssertions:       failedAssertions,
+	}
+
+	if c.RouteConfig.StoreReqBody {
+		reqBody := string(c.RequestBody)
+		l.RequestBody = &reqBody
+	}
+
+	storeDiffOnly := c.RouteConfig.StoreDiffOnly && len(bodyResult.Diff) > 0
+	if c.RouteConfig.StoreRespBodies && c.Main.Body != nil && !storeDiffOnly {
+		mainResBodyStr := string(c.Main.Body)
+		testResBodyStr := string(c.Test.Body)
+		l.MainUpstreamResponsePayload = &mainResBodyStr
+		l.TestUpstreamResponsePayload = &testResBodyStr
+	}
+
+	return l
+}
+
+// Recorder fingerprints, deduplicates, redacts and stores the records of the differences
+type Recorder struct {
+	Storage      storage.Storage
+	Fingerprints *fingerprint.Tracker
+}
+
+// Record stores the record of the comparison, unless dedup_limit is reached for its fingerprint
+func (r *Recorder) Record(c *Comparison, l storage.Log) {
+	// Not the route itself for requests without a route config, which would give every ID of a path its own
+	// fingerprint
+	fingerprintRoute := c.MetricsRoute()
+	l.Fingerprint = fingerprint.Of(fingerprintRoute, l)
+
+	stats, store := r.Fingerprints.Observe(l.Fingerprint, fingerprintRoute, time.Now(), c.RouteConfig.DedupLimit, c.RouteConfig.DedupWindow)
+	metrics.Fingerprints.Set(float64(r.Fingerprints.Len()))
+	l.FingerprintCount = stats.Count
+	if stats.Count == 1 {
+		logging.L.Info("New difference fingerprint", append(c.loggingFields(),
+			zap.String("fingerprint", l.Fingerprint), zap.Strings("comparison_types", l.ComparisonTypes))...)
+	}
+	if !store {
+		metrics.DedupSkipCounter.WithLabelValues(c.MetricsRoute()).Inc()
+		logging.L.Debug("Skipping the record, dedup_limit is reached for its fingerprint", append(c.loggingFields(),
+			zap.String("fingerprint", l.Fingerprint), zap.Uint64("count", stats.Count))...)
+		return
+	}
+
+	if err := r.Storage.Store(redaction.Apply(l, c.RouteConfig)); err != nil {
+		logging.L.Error("Error in logging the request into Storage", c.loggingFieldsWithError(err)...)
+	}
+}
+
+// compareHeaders compares two sets of HTTP headers and returns a list of headers that differ
+func compareHeaders(skipHeaders []string, mainHeaders, testHeaders http.Header) []string {
+	var differentHeaders []string
+	skipHeadersMap := make(map[string]bool)
+
+	// Build skip headers map
+	for _, header := range skipHeaders {
+		skipHeadersMap[strings.ToLower(header)] = true
+	}
+	// Check all headers in main response
+	for key, mainValues := range mainHeaders {
+		keyLower := strings.ToLower(key)
+		if skipHeadersMap[keyLower] {
+			continue
+		}
+
+		testValues, exists := testHeaders[key]
+		if !exists {
+			differentHeaders = append(differentHeaders, key)
+			continue
+		}
+
+		// Compare header values
+		if len(mainValues) != len(testValues) {
+			differentHeaders = append(differentHeaders, key)
+			continue
+		}
+
+		// Compare each value
+		different := false
+		for i, mainValue := range mainValues {
+			if mainValue != testValues[i] {
+				different = true
+				break
+			}
+		}
+
+		if different {
+			differentHeaders = append(differentHeaders, key)
+		}
+	}
+
+	// Check for headers that exist in test but not in main
+	for key := range testHeaders {
+		keyLower := strings.ToLower(key)
+		if skipHeadersMap[keyLower] {
+			continue
+		}
+
+		if _, exists := mainHeaders[key]; !exists {
+			differentHeaders = append(differentHeaders, key)
+		}
+	}
+
+	return differentHeaders
+}
+
+// withoutHeader returns the headers apart from name, which is compared case-insensitively
+func withoutHeader(headers []string, name string) []string {
+	kept := headers[:0]
+	for _, header := range headers {
+		if !strings.EqualFold(header, name) {
+			kept = append(kept, header)
+		}
+	}
+
+	return kept
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// isStatus2xx returns true if the status code is in the 2xx range (200-299)
+func isStatus2xx(statusCode int) bool {
+	return statusCode >= 200 && statusCode <= 299
+}
+
+// ValidateConfigs checks the comparators and the assertions of the computed route configs
+func ValidateConfigs(configs *config.ComputedRouteConfigs) error {
+	for route, routeConfig := range configs.Routes {
+		if _, _, err := comparator.Select(routeConfig, ""); err != nil {
+			return fmt.Errorf("invalid comparator in route_configs for %s: %w", route, err)
+		}
+
+		for _, assertion := range routeConfig.Assertions {
+			if err := comparator.CheckAssertion(assertion); err != nil {
+				return fmt.Errorf("invalid assertion in route_configs for %s %q: %w", route, assertion, err)
+			}
+		}
+	}
+
+	for _, assertion := range configs.Global.Assertions {
+		if err := comparator.CheckAssertion(assertion); err != nil {
+			return fmt.Errorf("invalid assertion in global_config %q: %w", assertion, err)
+		}
+	}
+
+	return nil
+}
+
+// LintConfigs returns the errors of every comparator and assertion of c, which ValidateConfigs reports one at a time
+func LintConfigs(c *config.HTTPConfig) []config.Issue {
+	var issues []config.Issue
+	for _, assertion := range c.GlobalConfig.Assertions {
+		if err := comparator.CheckAssertion(assertion); err != nil {
+			issues = append(issues, config.Issue{
+				Severity: config.SeverityError,
+				Key:      "global_config.assertions",
+				Message:  fmt.Sprintf("invalid assertion %q: %s", assertion, err),
+			})
+		}
+	}
+
+	computed := c.PrecomputeRouteConfigs()
+	patterns := make([]string, 0, len(c.RouteConfigs))
+	for pattern := range c.RouteConfigs {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		if _, _, err := comparator.Select(computed.Routes[pattern], ""); err != nil {
+			issues = append(issues, config.Issue{
+				Severity: config.SeverityError,
+				Key:      config.RouteConfigKey(pattern),
+				Message:  fmt.Sprintf("invalid comparator: %s", err),
+			})
+		}
+
+		// The global assertions are reported once
+		for _, assertion := range c.RouteConfigs[pattern].Assertions {
+			if err := comparator.CheckAssertion(assertion); err != nil {
+				issues = append(issues, config.Issue{
+					Severity: config.SeverityError,
+					Key:      config.RouteConfigKey(pattern),
+					Message:  fmt.Sprintf("invalid assertion %q: %s", assertion, err),
+				})
+			}
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/fingerprint"
+	"github.com/snapp-incubator/proksi/internal/metrics"
+	"github.com/snapp-incubator/proksi/internal/storage"
+)
+
+func TestCompare(t *testing.T) {
+	routeConfig := config.ComputedRouteConfig{
+		CompareHeaders:  true,
+		CompareBody:     true,
+		BodyCompareMode: config.BodyCompareAuto,
+		SkipHeaders:     []string{"Date"},
+	}
+	comparisonTypes := []string{"status_diff", "content_type_diff", "header_diff", "body_diff"}
+
+	tests := []struct {
+		name          string
+		main          Response
+		test          Response
+		wantTypes     []string
+		wantHeaders   []string
+		wantIncreased []string // Comparison types counted in the comparison_results metric
+	}{
+		{
+			name: "Equal responses",
+			main: NewResponse(200, http.Header{"Content-Type": {"application/json"}}, []byte(`{"id":1}`), 0),
+			test: NewResponse(200, http.Header{"Content-Type": {"application/json"}}, []byte(`{"id":1}`), 0),
+		},
+		{
+			name:          "Only the media type differs",
+			main:          NewResponse(200, http.Header{"Content-Type": {"application/json"}}, []byte(`{"id":1}`), 0),
+			test:          NewResponse(200, http.Header{"Content-Type": {"text/plain"}}, []byte(`{"id":1}`), 0),
+			wantTypes:     []string{"content_type_diff"},
+			wantHeaders:   []string{"Content-Type"},
+			wantIncreased: []string{"content_type_diff"},
+		},
+		{
+			name:          "Media type and another header differ",
+			main:          NewResponse(200, http.Header{"Content-Type": {"application/json"}, "X-Version": {"1"}}, []byte(`{"id":1}`), 0),
+			test:          NewResponse(200, http.Header{"Content-Type": {"text/plain"}, "X-Version": {"2"}}, []byte(`{"id":1}`), 0),
+			wantTypes:     []string{"content_type_diff", "header_diff"},
+			wantHeaders:   []string{"Content-Type", "X-Version"},
+			wantIncreased: []string{"content_type_diff", "header_diff"},
+		},
+		{
+			name:          "Status, media type and body differ",
+			main:          NewResponse(200, http.Header{"Content-Type": {"application/json"}}, []byte(`{"id":1}`), 0),
+			test:          NewResponse(500, http.Header{"Content-Type": {"text/html"}}, []byte(`<h1>error</h1>`), 0),
+			wantTypes:     []string{"status_diff", "content_type_diff", "body_diff"},
+			wantHeaders:   []string{"Content-Type"},
+			wantIncreased: []string{"status_diff", "content_type_diff", "body_diff"},
+		},
+		{
+			name:          "Status and body differ",
+			main:          NewResponse(200, http.Header{"Content-Type": {"application/json"}}, []byte(`{"id":1}`), 0),
+			test:          NewResponse(404, http.Header{"Content-Type": {"application/json"}}, []byte(`{"id":2}`), 0),
+			wantTypes:     []string{"status_diff", "body_diff"},
+			wantIncreased: []string{"status_diff", "body_diff"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := make(map[string]float64)
+			for _, comparisonType := range comparisonTypes {
+				before[comparisonType] = testutil.ToFloat64(metrics.ComparisonResults.WithLabelValues(comparisonType))
+			}
+
+			l := Compare(&Comparison{
+				Request:     httptest.NewRequest(http.MethodGet, "/api/users/1", nil),
+				Route:       "GET:/api/users/1",
+				RouteConfig: routeConfig,
+				Main:        tt.main,
+				Test:        tt.test,
+			})
+
+			var gotTypes, gotHeaders []string
+			if l != nil {
+				gotTypes, gotHeaders = l.ComparisonTypes, l.DifferentHeaders
+			}
+			if !reflect.DeepEqual(gotTypes, tt.wantTypes) {
+				t.Errorf("Compare() comparison types = %v, want %v", gotTypes, tt.wantTypes)
+			}
+			if !reflect.DeepEqual(gotHeaders, tt.wantHeaders) {
+				t.Errorf("Compare() different headers = %v, want %v", gotHeaders, tt.wantHeaders)
+			}
+
+			increased := make(map[string]bool)
+			for _, comparisonType := range tt.wantIncreased {
+				increased[comparisonType] = true
+			}
+			for _, comparisonType := range comparisonTypes {
+				want := before[comparisonType]
+				if increased[comparisonType] {
+					want++
+				}
+				if got := testutil.ToFloat64(metrics.ComparisonResults.WithLabelValues(comparisonType)); got != want {
+					t.Errorf("comparison_results{diff_type=%q} = %v, want %v", comparisonType, got, want)
+				}
+			}
+		})
+	}
+}
+
+type memoryStorage struct {
+	logs []storage.Log
+}
+
+func (s *memoryStorage) Store(l storage.Log) error {
+	s.logs = append(s.logs, l)
+	return nil
+}
+
+func TestRecorder_RecordWithoutRouteConfig(t *testing.T) {
+	recorder := &Recorder{Storage: &memoryStorage{}, Fingerprints: fingerprint.NewTracker(fingerprint.MaxFingerprints)}
+
+	for _, id := range []string{"1", "2", "3"} {
+		recorder.Record(&Comparison{
+			Request: httptest.NewRequest(http.MethodGet, "/api/users/"+id, nil),
+			Route:   "GET:/api/users/" + id,
+		}, storage.Log{ComparisonTypes: []string{"status_diff"}})
+	}
+
+	stats := recorder.Fingerprints.Snapshot()
+	if len(stats) != 1 || stats[0].Count != 3 || stats[0].Route != "global" {
+		t.Errorf("Snapshot() = %+v, want a single global fingerprint seen 3 times", stats)
+	}
+}
@@ -0,0 +1,248 @@
+// Package redaction masks secrets and personal data in the records before they are stored
+package redaction
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/jsonpath"
+	"github.com/snapp-incubator/proksi/internal/storage"
+)
+
+// Mask replaces the redacted values
+const Mask = "[REDACTED]"
+
+var (
+	builtinPatterns = map[string]*regexp.Regexp{
+		config.RedactCard:  regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		config.RedactEmail: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		config.RedactPhone: regexp.MustCompile(`(?:\+|\b00)\d{1,3}[ -]?\d{2,4}[ -]?\d{3,4}[ -]?\d{3,4}\b|\b0\d{2,3}[ -]?\d{3,4}[ -]?\d{4}\b`),
+	}
+
+	// patterns caches the compiled custom patterns
+	patterns sync.Map
+)
+
+// Apply returns the record with the redaction rules of the route applied to the request URL and headers, the request
+// and response bodies and the body diff
+func Apply(l storage.Log, routeConfig config.ComputedRouteConfig) storage.Log {
+	r := newRedactor(routeConfig)
+
+	l.URL = r.text(l.URL)
+	l.Headers = r.headers(l.Headers)
+	requestBody := l.RequestBody
+	l.RequestBody = r.body(l.RequestBody)
+	l.RequestBodyRedacted = l.RequestBodyRedacted || (requestBody != nil && *requestBody != *l.RequestBody)
+	l.MainUpstreamResponsePayload = r.body(l.MainUpstreamResponsePayload)
+	l.TestUpstreamResponsePayload = r.body(l.TestUpstreamResponsePayload)
+
+	if len(l.BodyDiff) > 0 {
+		diffs := make([]storage.BodyDiff, len(l.BodyDiff))
+		for i, diff := range l.BodyDiff {
+			segments := jsonpath.Split(diff.Path)
+			diff.Main = r.diffValue(segments, diff.Main)
+			diff.Test = r.diffValue(segments, diff.Test)
+			diffs[i] = diff
+		}
+		l.BodyDiff = diffs
+	}
+
+	return l
+}
+
+type redactor struct {
+	redactHeaders map[string]bool
+	redactPaths   [][]jsonpath.Step
+	hashPaths     [][]jsonpath.Step
+	patterns      []*regexp.Regexp
+}
+
+func newRedactor(routeConfig config.ComputedRouteConfig) *redactor {
+	r := &redactor{redactHeaders: make(map[string]bool)}
+	for _, header := range routeConfig.RedactHeaders {
+		r.redactHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	for _, path := range routeConfig.RedactJSONPaths {
+		r.redactPaths = append(r.redactPaths, jsonpath.ParsePattern(path))
+	}
+
+	for _, path := range routeConfig.HashJSONPaths {
+		r.hashPaths = append(r.hashPaths, jsonpath.ParsePattern(path))
+	}
+
+	for _, pattern := range routeConfig.RedactPatterns {
+		if re := compilePattern(pattern); re != nil {
+			r.patterns = append(r.patterns, re)
+		}
+	}
+
+	return r
+}
+
+// compilePattern returns the built-in pattern of the name or compiles the regular expression, nil when it is invalid
+// which cannot happen with a validated config
+func compilePattern(pattern string) *regexp.Regexp {
+	if re, ok := builtinPatterns[pattern]; ok {
+		return re
+	}
+
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil
+	}
+	patterns.Store(pattern, re)
+
+	return re
+}
+
+// headers returns a copy of the headers with the redacted headers masked and the patterns masked in the others
+func (r *redactor) headers(header map[string][]string) map[string][]string {
+	if header == nil {
+		return nil
+	}
+
+	redacted := make(map[string][]string, len(header))
+	for name, values := range header {
+		redactedValues := make([]string, len(values))
+		for i, value := range values {
+			if r.redactHeaders[http.CanonicalHeaderKey(name)] {
+				redactedValues[i] = Mask
+			} else {
+				redactedValues[i] = r.text(value)
+			}
+		}
+		redacted[name] = redactedValues
+	}
+
+	return redacted
+}
+
+// body redacts the JSON paths of a JSON body and masks the patterns in any body. A JSON body without values at the
+// paths is kept as it is rather than encoded again.
+func (r *redactor) body(body *string) *string {
+	if body == nil {
+		return nil
+	}
+
+	redacted := *body
+	if len(r.redactPaths) > 0 || len(r.hashPaths) > 0 {
+		var v interface{}
+		if err := json.Unmarshal([]byte(redacted), &v); err == nil {
+			original := encode(v)
+			if encoded := encode(r.value(nil, v)); encoded != original {
+				redacted = encoded
+			}
+		}
+	}
+
+	redacted = r.text(redacted)
+	return &redacted
+}
+
+// diffValue redacts a JSON encoded value of the body diff at the path given by segments
+func (r *redactor) diffValue(segments []string, value string) string {
+	if value == "" {
+		return value
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return r.text(value)
+	}
+
+	return r.text(encode(r.value(segments, v)))
+}
+
+// value redacts the decoded JSON value at the path given by segments and its descendants. The value is masked or
+// hashed when it is at or below a redacted or hashed path, e.g. a body diff of "payment.card" of the path "payment".
+func (r *redactor) value(segments []string, v interface{}) interface{} {
+	for _, path := range r.redactPaths {
+		if jsonpath.MatchPrefix(path, segments) {
+			return Mask
+		}
+	}
+
+	for _, path := range r.hashPaths {
+		if jsonpath.MatchPrefix(path, segments) {
+			sum := sha256.Sum256([]byte(encode(v)))
+			return "sha256:" + hex.EncodeToString(sum[:])
+		}
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			value[key] = r.value(jsonpath.Append(segments, key), child)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = r.value(jsonpath.Append(segments, strconv.Itoa(i)), child)
+		}
+	}
+
+	return v
+}
+
+// text masks the patterns in the text. Card number candidates are only masked when they pass the Luhn check.
+func (r *redactor) text(s string) string {
+	for _, re := range r.patterns {
+		if re == builtinPatterns[config.RedactCard] {
+			s = re.ReplaceAllStringFunc(s, func(match string) string {
+				if luhnValid(match) {
+					return Mask
+				}
+				return match
+			})
+			continue
+		}
+		s = re.ReplaceAllString(s, Mask)
+	}
+
+	return s
+}
+
+// luhnValid checks the Luhn checksum of the digits of a card number candidate
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+func encode(v interface{}) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(v)
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
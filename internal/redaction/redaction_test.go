@@ -0,0 +1,195 @@
+package redaction
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/storage"
+)
+
+const (
+	nationalIDHash = "sha256:b72a20f4f1af86ce62e30e92af8e013b98a20a26b5ae42f33e903778fc7e0598"
+	serialHash     = "sha256:a58f862593dfa1846ee77cfe970497d4b18241b98c14740e1eac09d9eba18695"
+)
+
+func TestApply(t *testing.T) {
+	routeConfig := config.ComputedRouteConfig{
+		RedactHeaders:   []string{"authorization", "X-Api-Key"},
+		RedactJSONPaths: []string{"password", "cards.#.number", "payment"},
+		HashJSONPaths:   []string{"user.national_id", "device"},
+		RedactPatterns:  []string{config.RedactEmail, config.RedactCard, config.RedactPhone, `token=\w+`},
+	}
+
+	body := func(s string) *string { return &s }
+
+	tests := []struct {
+		name     string
+		log      storage.Log
+		expected storage.Log
+	}{
+		{
+			name: "Headers",
+			log: storage.Log{
+				Headers: map[string][]string{
+					"Authorization": {"Bearer secret"},
+					"X-Api-Key":     {"key"},
+					"X-Contact":     {"john@example.com"},
+					"Accept":        {"application/json"},
+				},
+			},
+			expected: storage.Log{
+				Headers: map[string][]string{
+					"Authorization": {Mask},
+					"X-Api-Key":     {Mask},
+					"X-Contact":     {Mask},
+					"Accept":        {"application/json"},
+				},
+			},
+		},
+		{
+			name:     "URL",
+			log:      storage.Log{URL: "/api/users?email=john@example.com&token=abc123&page=2"},
+			expected: storage.Log{URL: "/api/users?email=[REDACTED]&[REDACTED]&page=2"},
+		},
+		{
+			name: "JSON bodies",
+			log: storage.Log{
+				RequestBody:                 body(`{"password":"secret","user":{"national_id":"0012345678","name":"John"}}`),
+				MainUpstreamResponsePayload: body(`{"cards":[{"number":"1234","bank":"A"}]}`),
+				TestUpstreamResponsePayload: body(`not json with john@example.com`),
+			},
+			expected: storage.Log{
+				RequestBody:                 body(`{"password":"[REDACTED]","user":{"name":"John","national_id":"` + nationalIDHash + `"}}`),
+				RequestBodyRedacted:         true,
+				MainUpstreamResponsePayload: body(`{"cards":[{"bank":"A","number":"[REDACTED]"}]}`),
+				TestUpstreamResponsePayload: body(`not json with [REDACTED]`),
+			},
+		},
+		{
+			name: "Body diff",
+			log: storage.Log{
+				BodyDiff: []storage.BodyDiff{
+					{Path: "password", Kind: storage.BodyDiffChanged, Main: `"a"`, Test: `"b"`},
+					{Path: "user", Kind: storage.BodyDiffAdded, Test: `{"national_id":"0012345678"}`},
+					{Path: "cards.0.number", Kind: storage.BodyDiffRemoved, Main: `"1234"`},
+					{Path: "contact", Kind: storage.BodyDiffChanged, Main: `"john@example.com"`, Test: `"+98 912 345 6789"`},
+				},
+			},
+			expected: storage.Log{
+				BodyDiff: []storage.BodyDiff{
+					{Path: "password", Kind: storage.BodyDiffChanged, Main: `"[REDACTED]"`, Test: `"[REDACTED]"`},
+					{Path: "user", Kind: storage.BodyDiffAdded, Test: `{"national_id":"` + nationalIDHash + `"}`},
+					{Path: "cards.0.number", Kind: storage.BodyDiffRemoved, Main: `"[REDACTED]"`},
+					{Path: "contact", Kind: storage.BodyDiffChanged, Main: `"[REDACTED]"`, Test: `"[REDACTED]"`},
+				},
+			},
+		},
+		{
+			name: "Body diff below redacted paths",
+			log: storage.Log{
+				BodyDiff: []storage.BodyDiff{
+					{Path: "payment.card", Kind: storage.BodyDiffChanged, Main: `"4111111111111112"`, Test: `"5500"`},
+					{Path: "payment.items.0", Kind: storage.BodyDiffAdded, Test: `{"amount":1500}`},
+					{Path: "cards.1.number.last4", Kind: storage.BodyDiffRemoved, Main: `"1234"`},
+					{Path: "device.serial", Kind: storage.BodyDiffChanged, Main: `"ABC123"`, Test: `"ABC123"`},
+					{Path: "devices.serial", Kind: storage.BodyDiffChanged, Main: `"ABC123"`, Test: `"XYZ"`},
+				},
+			},
+			expected: storage.Log{
+				BodyDiff: []storage.BodyDiff{
+					{Path: "payment.card", Kind: storage.BodyDiffChanged, Main: `"[REDACTED]"`, Test: `"[REDACTED]"`},
+					{Path: "payment.items.0", Kind: storage.BodyDiffAdded, Test: `"[REDACTED]"`},
+					{Path: "cards.1.number.last4", Kind: storage.BodyDiffRemoved, Main: `"[REDACTED]"`},
+					{Path: "device.serial", Kind: storage.BodyDiffChanged, Main: `"` + serialHash + `"`, Test: `"` + serialHash + `"`},
+					{Path: "devices.serial", Kind: storage.BodyDiffChanged, Main: `"ABC123"`, Test: `"XYZ"`},
+				},
+			},
+		},
+		{
+			name: "Redacted parent object",
+			log: storage.Log{
+				RequestBody: body(`{"payment":{"card":"4111111111111112","amount":1500},"order":7}`),
+			},
+			expected: storage.Log{
+				RequestBody:         body(`{"order":7,"payment":"[REDACTED]"}`),
+				RequestBodyRedacted: true,
+			},
+		},
+		{
+			name: "Card numbers are checked with Luhn",
+			log: storage.Log{
+				RequestBody: body(`paid with 4111 1111 1111 1111, order 4111111111111112`),
+			},
+			expected: storage.Log{
+				RequestBody:         body(`paid with [REDACTED], order 4111111111111112`),
+				RequestBodyRedacted: true,
+			},
+		},
+		{
+			name: "Local phone numbers",
+			log: storage.Log{
+				RequestBody: body(`call 09123456789 or 0098 912 345 6789, amount 1500`),
+			},
+			expected: storage.Log{
+				RequestBody:         body(`call [REDACTED] or [REDACTED], amount 1500`),
+				RequestBodyRedacted: true,
+			},
+		},
+		{
+			name:     "Request body without redacted values",
+			log:      storage.Log{RequestBody: body(`{"order": 7, "items": []}`)},
+			expected: storage.Log{RequestBody: body(`{"order": 7, "items": []}`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Apply(tt.log, routeConfig); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Apply() = %s, want %s", logJSON(got), logJSON(tt.expected))
+			}
+		})
+	}
+}
+
+func TestApplyDoesNotMutateRecord(t *testing.T) {
+	headers := map[string][]string{"Authorization": {"Bearer secret"}}
+	diff := []storage.BodyDiff{{Path: "password", Kind: storage.BodyDiffChanged, Main: `"a"`, Test: `"b"`}}
+	l := storage.Log{Headers: headers, BodyDiff: diff}
+
+	Apply(l, config.ComputedRouteConfig{RedactHeaders: []string{"Authorization"}, RedactJSONPaths: []string{"password"}})
+
+	if headers["Authorization"][0] != "Bearer secret" {
+		t.Errorf("Apply() mutated the request headers: %v", headers)
+	}
+	if diff[0].Main != `"a"` {
+		t.Errorf("Apply() mutated the body diff: %v", diff)
+	}
+}
+
+func TestLuhnValid(t *testing.T) {
+	tests := []struct {
+		number   string
+		expected bool
+	}{
+		{"4111111111111111", true},
+		{"4111-1111-1111-1111", true},
+		{"5500 0000 0000 0004", true},
+		{"4111111111111112", false},
+		{"1234567890123", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			if got := luhnValid(tt.number); got != tt.expected {
+				t.Errorf("luhnValid(%q) = %v, want %v", tt.number, got, tt.expected)
+			}
+		})
+	}
+}
+
+func logJSON(l storage.Log) string {
+	b, _ := json.Marshal(l)
+	return string(b)
+}
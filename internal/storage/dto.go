@@ -1,16 +1,46 @@
 package storage
 
+import "time"
+
 // Log defines the structure of records storing in Storage as log of requests
 type Log struct {
+	Timestamp                   time.Time           `json:"timestamp"` // Time the difference was found at
 	URL                         string              `json:"url"`
-	Method                      string              `json:"method"`                 // HTTP method
-	Route                       string              `json:"route"`                  // Formatted route (METHOD:/path)
-	Headers                     map[string][]string `json:"headers"`                // Request headers
-	RequestBody                 *string             `json:"request_body,omitempty"` // Request body (if StoreReqBody is enabled)
+	Host                        string              `json:"host,omitempty"`                  // Host requested by the client
+	Method                      string              `json:"method"`                          // HTTP method
+	Route                       string              `json:"route"`                           // Formatted route (METHOD:/path)
+	RouteTemplate               string              `json:"route_template,omitempty"`        // Pattern of the route config applied, e.g. "GET:/api/users/{id}"
+	RouteParams                 map[string]string   `json:"route_params,omitempty"`          // Named route parameters of RouteTemplate, e.g. {"id": "42"}
+	Headers                     map[string][]string `json:"headers"`                         // Request headers
+	RequestBody                 *string             `json:"request_body,omitempty"`          // Request body (if StoreReqBody is enabled)
+	RequestBodySize             int                 `json:"request_body_size,omitempty"`     // Size of the request body, whether it is stored or not
+	RequestBodyRedacted         bool                `json:"request_body_redacted,omitempty"` // RequestBody is changed by redaction
 	MainUpstreamStatusCode      int                 `json:"main_upstream_status_code"`
 	TestUpstreamStatusCode      int                 `json:"test_upstream_status_code"`
+	MainUpstreamDurationMs      float64             `json:"main_upstream_duration_ms"` // Time until the main upstream response headers
+	TestUpstreamDurationMs      float64             `json:"test_upstream_duration_ms"` // Time until the test upstream response headers
 	MainUpstreamResponsePayload *string             `json:"main_upstream_response_payload"`
 	TestUpstreamResponsePayload *string             `json:"test_upstream_response_payload"`
-	ComparisonType              string              `json:"comparison_type,omitempty"`   // "status_diff", "header_diff", "body_diff"
+	ComparisonType              string              `json:"comparison_type,omitempty"`   // First of ComparisonTypes
+	ComparisonTypes             []string            `json:"comparison_types,omitempty"`  // "status_diff", "content_type_diff", "header_diff", "body_diff", "latency_diff", "assertion_failed"
 	DifferentHeaders            []string            `json:"different_headers,omitempty"` // List of headers that differed
+	BodyDiff                    []BodyDiff          `json:"body_diff,omitempty"`         // Structured differences of the bodies, if the comparator supports them
+	FailedAssertions            []string            `json:"failed_assertions,omitempty"` // Text of the failed route assertions
+	Fingerprint                 string              `json:"fingerprint,omitempty"`       // Identifies the records of the same difference, see package fingerprint
+	FingerprintCount            uint64              `json:"fingerprint_count,omitempty"` // Occurrences of the fingerprint since the start of the process, including this one
+}
+
+// Kinds of BodyDiff
+const (
+	BodyDiffChanged = "changed" // The value differs in the test response
+	BodyDiffAdded   = "added"   // The path exists only in the test response
+	BodyDiffRemoved = "removed" // The path exists only in the main response
+)
+
+// BodyDiff is a single difference between the main and test upstream response bodies
+type BodyDiff struct {
+	Path string `json:"path"`           // Path of the difference in the skip_json_paths syntax, e.g. "items.2.price"
+	Kind string `json:"kind"`           // "changed", "added" or "removed"
+	Main string `json:"main,omitempty"` // JSON encoded value in the main response, absent for "added"
+	Test string `json:"test,omitempty"` // JSON encoded value in the test response, absent for "removed"
 }
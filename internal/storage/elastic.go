@@ -11,6 +11,9 @@ import (
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
+// scrollTimeout is how long Elasticsearch keeps the search context between the pages of Read
+const scrollTimeout = time.Minute
+
 // ElasticStorage is the backend Storage interface that works with Elasticsearch
 type ElasticStorage struct {
 	ES *elasticsearch.Client
@@ -19,9 +22,8 @@ type ElasticStorage struct {
 // Store is the action of storing
 func (s ElasticStorage) Store(l Log) error {
 	b, _ := json.Marshal(&l)
-	now := time.Now()
 	r := esapi.IndexRequest{
-		Index: fmt.Sprintf("%d-%d-%d", now.Year(), now.Month(), now.Day()),
+		Index: indexName(time.Now()),
 		Body:  bytes.NewReader(b),
 	}
 
@@ -30,3 +32,146 @@ func (s ElasticStorage) Store(l Log) error {
 
 	return err
 }
+
+// Read calls fn with the stored records matching the filter, until fn returns an error. Only the daily indices of the
+// time range of the filter are searched when it has a start.
+func (s ElasticStorage) Read(f Filter, fn func(Log) error) error {
+	query, err := json.Marshal(elasticQuery(f))
+	if err != nil {
+		return err
+	}
+
+	res, err := s.ES.Search(
+		s.ES.Search.WithIndex(indices(f)...),
+		s.ES.Search.WithBody(bytes.NewReader(query)),
+		s.ES.Search.WithSize(500),
+		s.ES.Search.WithSort("_doc"),
+		s.ES.Search.WithScroll(scrollTimeout),
+		s.ES.Search.WithIgnoreUnavailable(true),
+		s.ES.Search.WithAllowNoIndices(true),
+	)
+
+	var scrollID string
+	defer func() {
+		if scrollID == "" {
+			return
+		}
+		if res, err := s.ES.ClearScroll(s.ES.ClearScroll.WithScrollID(scrollID)); err == nil {
+			_ = res.Body.Close()
+		}
+	}()
+
+	for {
+		var page elasticPage
+		if page, err = decodePage(res, err); err != nil {
+			return err
+		}
+		scrollID = page.ScrollID
+
+		if len(page.Hits.Hits) == 0 {
+			return nil
+		}
+
+		for _, hit := range page.Hits.Hits {
+			// The records are filtered again for the route patterns, which the query does not support
+			if !f.Match(hit.Source) {
+				continue
+			}
+
+			if err = fn(hit.Source); err != nil {
+				return err
+			}
+		}
+
+		res, err = s.ES.Scroll(s.ES.Scroll.WithScrollID(scrollID), s.ES.Scroll.WithScroll(scrollTimeout))
+	}
+}
+
+type elasticPage struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []struct {
+			Source Log `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+func decodePage(res *esapi.Response, err error) (elasticPage, error) {
+	if err != nil {
+		return elasticPage{}, fmt.Errorf("error in searching Elasticsearch: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.IsError() {
+		return elasticPage{}, fmt.Errorf("error in searching Elasticsearch: %s", res.String())
+	}
+
+	var page elasticPage
+	if err = json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return elasticPage{}, fmt.Errorf("error in decoding the Elasticsearch response: %w", err)
+	}
+
+	return page, nil
+}
+
+// elasticQuery returns the query of the filter, except for the route patterns
+func elasticQuery(f Filter) map[string]interface{} {
+	var filters []interface{}
+
+	for field, values := range map[string][]string{"fingerprint": f.Fingerprints, "comparison_types": f.ComparisonTypes} {
+		if len(values) == 0 {
+			continue
+		}
+
+		var should []interface{}
+		for _, v := range values {
+			should = append(should, map[string]interface{}{"match": map[string]interface{}{field: v}})
+		}
+		filters = append(filters, map[string]interface{}{"bool": map[string]interface{}{"should": should, "minimum_should_match": 1}})
+	}
+
+	timestamp := map[string]interface{}{}
+	if !f.Since.IsZero() {
+		timestamp["gte"] = f.Since.Format(time.RFC3339Nano)
+	}
+	if !f.Until.IsZero() {
+		timestamp["lt"] = f.Until.Format(time.RFC3339Nano)
+	}
+	if len(timestamp) > 0 {
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"timestamp": timestamp}})
+	}
+
+	return map[string]interface{}{"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}}}
+}
+
+// indexName returns the daily index of the records stored at t
+func indexName(t time.Time) string {
+	return fmt.Sprintf("%d-%d-%d", t.Year(), t.Month(), t.Day())
+}
+
+// indices returns the daily indices of the time range of the filter, or all of them when it has no start
+func indices(f Filter) []string {
+	if f.Since.IsZero() {
+		return []string{"*-*-*"}
+	}
+
+	until := f.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+
+	// Indices are named after the local day of storing
+	var names []string
+	for day := startOfDay(f.Since.In(time.Local)); day.Before(until); day = day.AddDate(0, 0, 1) {
+		names = append(names, indexName(day))
+	}
+	if len(names) == 0 {
+		names = append(names, indexName(f.Since.In(time.Local)))
+	}
+
+	return names
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+)
+
+// Filter selects stored records. Empty fields match all records.
+type Filter struct {
+	Routes          []string  // Route patterns, in the route_configs syntax, the route of the record matches
+	Fingerprints    []string  // Fingerprints, one of which the record has
+	ComparisonTypes []string  // Comparison types, one of which the record has
+	Since           time.Time // Records stored at or after it
+	Until           time.Time // Records stored before it
+}
+
+// Match returns whether the record is selected by the filter
+func (f Filter) Match(l Log) bool {
+	if len(f.Routes) > 0 && !matchAny(f.Routes, func(route string) bool { return config.MatchRoute(l.Route, route) }) {
+		return false
+	}
+
+	if len(f.Fingerprints) > 0 && !matchAny(f.Fingerprints, func(fingerprint string) bool { return fingerprint == l.Fingerprint }) {
+		return false
+	}
+
+	if len(f.ComparisonTypes) > 0 && !matchAny(f.ComparisonTypes, func(comparisonType string) bool {
+		return matchAny(l.ComparisonTypes, func(t string) bool { return t == comparisonType })
+	}) {
+		return false
+	}
+
+	if !f.Since.IsZero() && l.Timestamp.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && !l.Timestamp.Before(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+func matchAny(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReadJSONL calls fn with the records of the output of StdoutStorage matching the filter, until fn returns an error.
+// Lines which are not records, e.g. application logs of the same output, are skipped.
+func ReadJSONL(r io.Reader, f Filter, fn func(Log) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+
+	for scanner.Scan() {
+		var l Log
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil || l.Method == "" || l.MainUpstreamStatusCode == 0 {
+			continue
+		}
+
+		if !f.Match(l) {
+			continue
+		}
+
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
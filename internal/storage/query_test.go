@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilter_Match(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	l := Log{
+		Timestamp:       now,
+		Method:          "GET",
+		URL:             "/api/users/42",
+		Route:           "GET:/api/users/42",
+		ComparisonTypes: []string{"status_diff", "body_diff"},
+		Fingerprint:     "0123456789abcdef",
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{
+			name:   "Empty filter",
+			filter: Filter{},
+			want:   true,
+		},
+		{
+			name:   "Route pattern",
+			filter: Filter{Routes: []string{"POST:/api/users", "GET:/api/users/*"}},
+			want:   true,
+		},
+		{
+			name:   "Other route",
+			filter: Filter{Routes: []string{"GET:/api/orders/*"}},
+			want:   false,
+		},
+		{
+			name:   "Fingerprint",
+			filter: Filter{Fingerprints: []string{"0123456789abcdef"}},
+			want:   true,
+		},
+		{
+			name:   "Other fingerprint",
+			filter: Filter{Fingerprints: []string{"fedcba9876543210"}},
+			want:   false,
+		},
+		{
+			name:   "One of the comparison types",
+			filter: Filter{ComparisonTypes: []string{"header_diff", "body_diff"}},
+			want:   true,
+		},
+		{
+			name:   "Other comparison types",
+			filter: Filter{ComparisonTypes: []string{"latency_diff"}},
+			want:   false,
+		},
+		{
+			name:   "In time range",
+			filter: Filter{Since: now, Until: now.Add(time.Second)},
+			want:   true,
+		},
+		{
+			name:   "Before time range",
+			filter: Filter{Since: now.Add(time.Second)},
+			want:   false,
+		},
+		{
+			name:   "At the end of time range",
+			filter: Filter{Until: now},
+			want:   false,
+		},
+		{
+			name:   "All of the fields must match",
+			filter: Filter{Routes: []string{"GET:/api/users/*"}, ComparisonTypes: []string{"latency_diff"}},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(l); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	output := strings.Join([]string{
+		`{"timestamp":"2024-05-01T10:30:00Z","url":"/a","method":"GET","route":"GET:/a","main_upstream_status_code":200,"test_upstream_status_code":500,"comparison_types":["status_diff"]}`,
+		`{"level":"warn","msg":"Different status code from services","method":"GET","url":"/a","route":"GET:/a"}`,
+		`not json`,
+		``,
+		`{"timestamp":"2024-05-01T10:31:00Z","url":"/b","method":"POST","route":"POST:/b","main_upstream_status_code":200,"test_upstream_status_code":200,"comparison_types":["body_diff"]}`,
+	}, "\n")
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{
+			name:   "All records",
+			filter: Filter{},
+			want:   []string{"/a", "/b"},
+		},
+		{
+			name:   "Filtered records",
+			filter: Filter{ComparisonTypes: []string{"body_diff"}},
+			want:   []string{"/b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := ReadJSONL(strings.NewReader(output), tt.filter, func(l Log) error {
+				got = append(got, l.URL)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ReadJSONL() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadJSONL() records = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndices(t *testing.T) {
+	since := time.Date(2024, 4, 29, 23, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{
+			name:   "No start",
+			filter: Filter{},
+			want:   []string{"*-*-*"},
+		},
+		{
+			name:   "Days of the range",
+			filter: Filter{Since: since, Until: since.Add(26 * time.Hour)},
+			want:   []string{"2024-4-29", "2024-4-30", "2024-5-1"},
+		},
+		{
+			name:   "Empty range",
+			filter: Filter{Since: since, Until: since},
+			want:   []string{"2024-4-29"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := indices(tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("indices() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,55 @@
 package storage
 
+import (
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"go.uber.org/zap"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/logging"
+)
+
 // Storage defines the behavior of log storage
 type Storage interface {
 	// Store is the action of storing
 	Store(Log) error
 }
+
+// New creates the storage backend of the storage_type of the config
+func New(c *config.HTTPConfig) (Storage, error) {
+	switch c.StorageType {
+	case "stdout":
+		logging.L.Info("Using stdout storage backend")
+		return &StdoutStorage{}, nil
+	case "elasticsearch":
+		return NewElastic(c.Elasticsearch)
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", c.StorageType)
+	}
+}
+
+// NewElastic connects to Elasticsearch
+func NewElastic(c config.Elasticsearch) (*ElasticStorage, error) {
+	elasticConfig := elasticsearch.Config{
+		Addresses:              c.Addresses,
+		Username:               c.Username,
+		Password:               c.Password,
+		CloudID:                c.CloudID,
+		APIKey:                 c.APIKey,
+		ServiceToken:           c.ServiceToken,
+		CertificateFingerprint: c.CertificateFingerprint,
+	}
+	es, err := elasticsearch.NewClient(elasticConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error in connecting to Elasticsearch: %w", err)
+	}
+
+	esInfo, err := es.Info()
+	if err != nil {
+		return nil, fmt.Errorf("error in getting info from Elasticsearch: %w", err)
+	}
+
+	logging.L.Info("Connected to Elasticsearch", zap.String("info", esInfo.String()))
+	return &ElasticStorage{ES: es}, nil
+}
@@ -0,0 +1,152 @@
+package upstream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"sync"
+)
+
+var errClosed = errors.New("capture reader is closed")
+
+// CaptureReader streams the underlying reader while keeping a copy of the read bytes up to limit. Once the limit is
+// exceeded the copy is dropped, but reading continues untouched. The size and optionally the SHA-256 digest of the
+// whole stream are kept regardless of the limit.
+//
+// A CaptureReader can be read in another goroutine than the one using what it captured, as the HTTP transport does
+// with request bodies. The stream is done at the first error, io.EOF included, or when the CaptureReader is closed,
+// and nothing is captured afterwards.
+type CaptureReader struct {
+	r     io.Reader
+	keep  bool  // Whether to keep a copy of the read bytes
+	limit int64 // 0 means unlimited
+
+	mu         sync.Mutex
+	done       chan struct{}
+	err        error // Error which ended the stream, io.EOF when it was read until the end
+	buf        bytes.Buffer
+	size       int64
+	digest     hash.Hash
+	overflowed bool
+}
+
+// NewCaptureReader returns a CaptureReader which keeps a copy of the stream up to limit bytes
+func NewCaptureReader(r io.Reader, limit int64) *CaptureReader {
+	return &CaptureReader{r: r, keep: true, limit: limit, done: make(chan struct{})}
+}
+
+// NewDigestReader returns a CaptureReader which only keeps the size and the digest of the stream
+func NewDigestReader(r io.Reader) *CaptureReader {
+	return &CaptureReader{r: r, digest: sha256.New(), done: make(chan struct{})}
+}
+
+// NewSizeReader returns a CaptureReader which only keeps the size of the stream
+func NewSizeReader(r io.Reader) *CaptureReader {
+	return &CaptureReader{r: r, done: make(chan struct{})}
+}
+
+// WithDigest makes the CaptureReader keep the digest of the stream as well, it must be called before reading
+func (c *CaptureReader) WithDigest() *CaptureReader {
+	c.digest = sha256.New()
+	return c
+}
+
+// Keeps checks whether the CaptureReader keeps a copy of the read bytes
+func (c *CaptureReader) Keeps() bool {
+	return c.keep
+}
+
+func (c *CaptureReader) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	// The lock is not held while reading, so that Close does not wait for a blocked read
+	n, err := c.r.Read(p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	if n > 0 {
+		c.size += int64(n)
+
+		if c.digest != nil {
+			c.digest.Write(p[:n])
+		}
+
+		if c.keep && !c.overflowed {
+			if c.limit > 0 && int64(c.buf.Len()+n) > c.limit {
+				c.overflowed = true
+				c.buf = bytes.Buffer{}
+			} else {
+				c.buf.Write(p[:n])
+			}
+		}
+	}
+
+	if err != nil {
+		c.finish(err)
+	}
+
+	return n, err
+}
+
+// Close stops the capture, the stream is not read anymore. The underlying reader is not closed.
+func (c *CaptureReader) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err == nil {
+		c.finish(errClosed)
+	}
+	return nil
+}
+
+// finish marks the stream as done with err, c.mu must be held
+func (c *CaptureReader) finish(err error) {
+	c.err = err
+	close(c.done)
+}
+
+// Done returns a channel which is closed when the stream is done
+func (c *CaptureReader) Done() <-chan struct{} {
+	return c.done
+}
+
+// Captured returns the captured bytes, which are not modified anymore. ok is false when the body is not kept,
+// exceeded the limit or was not read until the end, which includes a stream still being read.
+func (c *CaptureReader) Captured() (b []byte, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.keep || c.overflowed || c.err != io.EOF {
+		return nil, false
+	}
+
+	return c.buf.Bytes(), true
+}
+
+// Digest returns the size and the SHA-256 digest of the stream. ok is false when the stream was not read until the end.
+func (c *CaptureReader) Digest() (size int64, sum []byte, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != io.EOF {
+		return 0, nil, false
+	}
+
+	if c.digest != nil {
+		sum = c.digest.Sum(nil)
+	}
+
+	return c.size, sum, true
+}
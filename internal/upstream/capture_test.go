@@ -0,0 +1,103 @@
+package upstream
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCaptureReader_Captured(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		limit  int64
+		read   int // Bytes read before closing, -1 reads until the end
+		want   string
+		wantOk bool
+	}{
+		{name: "Read until the end", body: "hello world", read: -1, want: "hello world", wantOk: true},
+		{name: "Within the limit", body: "hello world", limit: 11, read: -1, want: "hello world", wantOk: true},
+		{name: "Exceeding the limit", body: "hello world", limit: 10, read: -1},
+		{name: "Closed before the end", body: "hello world", read: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCaptureReader(strings.NewReader(tt.body), tt.limit)
+			if tt.read < 0 {
+				_, _ = io.Copy(io.Discard, c)
+			} else {
+				_, _ = io.ReadFull(c, make([]byte, tt.read))
+				_ = c.Close()
+				if n, err := c.Read(make([]byte, 1)); n != 0 || err == nil {
+					t.Errorf("Read() after Close() = %d, %v, want an error", n, err)
+				}
+			}
+
+			got, ok := c.Captured()
+			if string(got) != tt.want || ok != tt.wantOk {
+				t.Errorf("Captured() = %q, %t, want %q, %t", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+// The upstream answers before reading the request body, which the transport keeps sending in its own goroutine
+func TestCaptureReader_RequestBodyAfterResponse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\n")
+		_, _ = io.Copy(io.Discard, req.Body)
+		_, _ = io.WriteString(conn, "ok")
+	}()
+
+	body, bodyWriter := io.Pipe()
+	c := NewCaptureReader(body, 0)
+	req, err := http.NewRequest(http.MethodPost, "http://"+listener.Addr().String(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := (&http.Client{Transport: &http.Transport{}}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	want := bytes.Repeat([]byte("body"), 1<<14)
+	go func() {
+		for i := 0; i < len(want); i += 1 << 12 {
+			_, _ = bodyWriter.Write(want[i : i+1<<12])
+		}
+		_ = bodyWriter.Close()
+	}()
+
+	<-c.Done()
+	got, ok := c.Captured()
+	if !ok || !bytes.Equal(got, want) {
+		t.Errorf("Captured() = %d bytes, %t, want %d bytes, true", len(got), ok, len(want))
+	}
+
+	if b, err := io.ReadAll(res.Body); err != nil || string(b) != "ok" {
+		t.Errorf("Response body = %q, %v, want ok", b, err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package upstream sends the requests to the upstreams and captures their bodies
+package upstream
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/snapp-incubator/proksi/internal/config"
+)
+
+// NewClient builds the HTTP client of an upstream with its own transport from the upstream config
+func NewClient(u config.HTTPUpstream) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(u)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   u.DialTimeout,
+		KeepAlive: u.KeepAlive,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   u.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: u.ResponseHeaderTimeout,
+		IdleConnTimeout:       u.IdleConnTimeout,
+		MaxIdleConns:          u.MaxIdleConns,
+		MaxIdleConnsPerHost:   u.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       u.MaxConnsPerHost,
+		DisableKeepAlives:     u.DisableKeepAlives,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     u.HTTP2,
+	}
+
+	if !u.HTTP2 {
+		// A non-nil empty map disables HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   u.Timeout,
+	}, nil
+}
+
+// newTLSConfig builds the TLS config of an upstream. The system CA pool is extended with the configured bundle
+func newTLSConfig(u config.HTTPUpstream) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         u.TLS.ServerName,
+		InsecureSkipVerify: u.TLS.InsecureSkipVerify,
+	}
+
+	if u.TLS.CAFile != "" {
+		pem, err := os.ReadFile(u.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA bundle of %s: %w", u.Address, err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the CA bundle of %s", u.Address)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if u.TLS.CertFile != "" || u.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(u.TLS.CertFile, u.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate of %s: %w", u.Address, err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/snapp-incubator/proksi/internal/capture"
+	"github.com/snapp-incubator/proksi/internal/config"
+	"github.com/snapp-incubator/proksi/internal/fingerprint"
+	"github.com/snapp-incubator/proksi/internal/logging"
+	"github.com/snapp-incubator/proksi/internal/metrics"
+	"github.com/snapp-incubator/proksi/internal/pipeline"
+	"github.com/snapp-incubator/proksi/internal/storage"
+	"github.com/snapp-incubator/proksi/internal/upstream"
+)
+
+// Sources of the replayed requests
+const (
+	sourceCapture       = "capture"       // Capture files of the proxy
+	sourceStdout        = "stdout"        // Differences stored by the stdout storage backend
+	sourceElasticsearch = "elasticsearch" // Differences stored by the Elasticsearch storage backend
+)
+
+// Upstreams the requests are sent to
+const (
+	upstreamsTest = "test" // Only the test upstream, compared with the captured main upstream responses
+	upstreamsBoth = "both" // Both upstreams, compared with each other
+)
+
+// Results of a replayed request
+const (
+	resultIdentical = "identical"
+	resultDifferent = "different"
+	resultSkipped   = "skipped"
+	resultFailed    = "failed"
+)
+
+var (
+	help         bool        // Indicates whether to show the help or not
+	configPath   string      // Path of config file
+	source       string      // Source of the replayed requests
+	upstreams    string      // Upstreams the requests are sent to
+	concurrency  uint        // Number of requests replayed concurrently
+	headers      headerFlags // Headers set on every replayed request
+	routes       string      // Route patterns of the replayed differences
+	fingerprints string      // Fingerprints of the replayed differences
+	types        string      // Comparison types of the replayed differences
+	since        string      // Start of the time range of the replayed differences
+	until        string      // End of the time range of the replayed differences
+)
+
+func init() {
+	flag.BoolVar(&help, "help", false, "Show help")
+	flag.StringVar(&configPath, "config", "", "The path of config file")
+	flag.StringVar(&source, "source", sourceCapture, `"capture" to replay capture files, "stdout" or "elasticsearch" to replay stored differences`)
+	flag.StringVar(&upstreams, "upstreams", "", `"test" to compare the test upstream with the captured responses, "both" to send the requests to both upstreams (default "test" for captures, "both" for differences)`)
+	flag.UintVar(&concurrency, "concurrency", 10, "Number of requests replayed concurrently")
+	flag.Var(&headers, "header", `Header set on every replayed request, e.g. "Authorization: Bearer ..." for redacted records. Can be repeated`)
+	flag.StringVar(&routes, "route", "", "Comma-separated route patterns of the replayed differences")
+	flag.StringVar(&fingerprints, "fingerprint", "", "Comma-separated fingerprints of the replayed differences")
+	flag.StringVar(&types, "type", "", `Comma-separated comparison types of the replayed differences, e.g. "status_diff,body_diff"`)
+	flag.StringVar(&since, "since", "", `Replay the differences stored since an RFC 3339 time or a duration ago, e.g. "24h"`)
+	flag.StringVar(&until, "until", "", `Replay the differences stored before an RFC 3339 time or a duration ago`)
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -config <config file> [flags] [<capture or stdout output file or directory>...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	// Parse the terminal flags
+	flag.Parse()
+}
+
+// headerFlags collects the repeated -header flags
+type headerFlags http.Header
+
+func (h *headerFlags) String() string {
+	return fmt.Sprint(http.Header(*h))
+}
+
+func (h *headerFlags) Set(value string) error {
+	name, v, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("header %q must be in the form \"Name: value\"", value)
+	}
+
+	if *h == nil {
+		*h = headerFlags{}
+	}
+	http.Header(*h).Add(strings.TrimSpace(name), strings.TrimSpace(v))
+
+	return nil
+}
+
+// request is a request to replay
+type request struct {
+	entry  capture.Entry
+	record *storage.Log // Stored difference the request is rebuilt from, nil for the captured requests
+}
+
+// report is the outcome of replaying a stored difference, written to stdout
+type report struct {
+	Result                  string   `json:"result"`
+	Method                  string   `json:"method"`
+	URL                     string   `json:"url"`
+	Route                   string   `json:"route"`
+	Fingerprint             string   `json:"fingerprint,omitempty"`
+	PreviousComparisonTypes []string `json:"previous_comparison_types"`
+	ComparisonTypes         []string `json:"comparison_types,omitempty"`
+}
+
+// summary counts the results of the replayed requests
+type summary struct {
+	replayed  uint64
+	identical uint64
+	different uint64
+	skipped   uint64
+	failed    uint64
+}
+
+type replayer struct {
+	mainServiceClient *http.Client // nil unless the requests are sent to both upstreams
+	testServiceClient *http.Client
+	recorder          *pipeline.Recorder // nil when replaying stored differences, which are only reported
+	summary           summary
+
+	reportMu sync.Mutex
+	reports  *json.Encoder
+}
+
+func main() {
+	// Usage Demo
+	if help {
+		flag.Usage()
+		return
+	}
+
+	c := config.LoadHTTP(configPath)
+
+	// Initialize logging with configured level
+	if err := logging.InitializeLogger(c.LogLevel); err != nil {
+		logging.L.Fatal("Failed to initialize logger", zap.Error(err))
+	}
+
+	filter, err := newFilter()
+	if err != nil {
+		logging.L.Fatal("Invalid filter", zap.Error(err))
+	}
+
+	switch source {
+	case sourceCapture:
+		if upstreams == "" {
+			upstreams = upstreamsTest
+		}
+		if routes != "" || fingerprints != "" || types != "" || since != "" || until != "" {
+			logging.L.Fatal("Filters only apply to stored differences")
+		}
+	case sourceStdout, sourceElasticsearch:
+		if upstreams == "" {
+			upstreams = upstreamsBoth
+		}
+		if upstreams != upstreamsBoth {
+			logging.L.Fatal("Stored differences can only be replayed to both upstreams, their main upstream responses are not complete")
+		}
+	default:
+		logging.L.Fatal("Invalid source, must be capture, stdout or elasticsearch", zap.String("source", source))
+	}
+
+	if upstreams != upstreamsTest && upstreams != upstreamsBoth {
+		logging.L.Fatal("Invalid upstreams, must be test or both", zap.String("upstreams", upstreams))
+	}
+
+	if c.Upstreams.Test.Address == "" {
+		logging.L.Fatal("Test upstream backend can not be empty.")
+	}
+
+	if upstreams == upstreamsBoth && c.Upstreams.Main.Address == "" {
+		logging.L.Fatal("Main upstream backend can not be empty.")
+	}
+
+	read, err := newReader(c, filter)
+	if err != nil {
+		logging.L.Fatal("Error in opening the source", zap.String("source", source), zap.Error(err))
+	}
+
+	if err := pipeline.ValidateConfigs(config.ComputedConfigs()); err != nil {
+		logging.L.Fatal("Invalid route configs", zap.Error(err))
+	}
+
+	r := &replayer{reports: json.NewEncoder(os.Stdout)}
+
+	r.testServiceClient, err = upstream.NewClient(c.Upstreams.Test)
+	if err != nil {
+		logging.L.Fatal("Error in creating the test upstream client", zap.Error(err))
+	}
+
+	if upstreams == upstreamsBoth {
+		r.mainServiceClient, err = upstream.NewClient(c.Upstreams.Main)
+		if err != nil {
+			logging.L.Fatal("Error in creating the main upstream client", zap.Error(err))
+		}
+	}
+
+	if source == sourceCapture {
+		r.recorder = &pipeline.Recorder{Fingerprints: fingerprint.NewTracker(fingerprint.MaxFingerprints)}
+		r.recorder.Storage, err = storage.New(c)
+		if err != nil {
+			logging.L.Fatal("Error in initializing the storage backend", zap.Error(err))
+		}
+	}
+
+	requests := make(chan request)
+	var wg sync.WaitGroup
+	for i := uint(0); i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range requests {
+				r.replay(req)
+			}
+		}()
+	}
+
+	if err = read(func(req request) error {
+		requests <- req
+		return nil
+	}); err != nil {
+		logging.L.Error("Error in reading the requests", zap.String("source", source), zap.Error(err))
+		atomic.AddUint64(&r.summary.failed, 1)
+	}
+
+	close(requests)
+	wg.Wait()
+
+	fmt.Fprintf(os.Stderr, "replayed: %d, identical: %d, different: %d, skipped: %d, failed: %d\n",
+		r.summary.replayed, r.summary.identical, r.summary.different, r.summary.skipped, r.summary.failed)
+
+	if r.summary.different > 0 || r.summary.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// newFilter returns the filter of the stored differences given by the flags
+func newFilter() (storage.Filter, error) {
+	f := storage.Filter{
+		Routes:          splitList(routes),
+		Fingerprints:    splitList(fingerprints),
+		ComparisonTypes: splitList(types),
+	}
+
+	var err error
+	if f.Since, err = parseTime(since); err != nil {
+		return storage.Filter{}, fmt.Errorf("since: %w", err)
+	}
+	if f.Until, err = parseTime(until); err != nil {
+		return storage.Filter{}, fmt.Errorf("until: %w", err)
+	}
+
+	for _, route := range f.Routes {
+		if method, path, ok := strings.Cut(route, ":"); !ok || method == "" || !strings.HasPrefix(path, "/") {
+			return storage.Filter{}, fmt.Errorf("route %q must be in the form METHOD:/path", route)
+		}
+	}
+
+	return f, nil
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// parseTime parses an RFC 3339 time or a duration before now
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// newReader returns the function reading the requests of the source
+func newReader(c *config.HTTPConfig, filter storage.Filter) (func(fn func(request) error) error, error) {
+	fromRecord := func(fn func(request) error) func(storage.Log) error {
+		return func(l storage.Log) error {
+			return fn(request{entry: recordEntry(l), record: &l})
+		}
+	}
+
+	switch source {
+	case sourceElasticsearch:
+		if flag.NArg() > 0 {
+			return nil, fmt.Errorf("files are not read from Elasticsearch")
+		}
+
+		es, err := storage.NewElastic(c.Elasticsearch)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(fn func(request) error) error {
+			return es.Read(filter, fromRecord(fn))
+		}, nil
+	case sourceStdout:
+		files, err := inputFiles()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(fn func(request) error) error {
+			return readFiles(files, func(file string) error {
+				logging.L.Info("Replaying the differences of file", zap.String("file", file))
+				return readStdoutFile(file, filter, fromRecord(fn))
+			})
+		}, nil
+	default:
+		files, err := inputFiles()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(fn func(request) error) error {
+			return readFiles(files, func(file string) error {
+				logging.L.Info("Replaying capture file", zap.String("file", file))
+				return capture.ReadFile(file, func(e capture.Entry) error {
+					return fn(request{entry: e})
+				})
+			})
+		}, nil
+	}
+}
+
+// inputFiles returns the files of the arguments, in which "-" stands for stdin
+func inputFiles() ([]string, error) {
+	var files []string
+	var paths []string
+	for _, arg := range flag.Args() {
+		if arg == "-" {
+			files = append(files, arg)
+			continue
+		}
+		paths = append(paths, arg)
+	}
+
+	captureFiles, err := capture.Files(paths)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, captureFiles...)
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no input files")
+	}
+
+	return files, nil
+}
+
+// readFiles reads all files, also after the ones which can not be read
+func readFiles(files []string, read func(file string) error) error {
+	failed := 0
+	for _, file := range files {
+		if err := read(file); err != nil {
+			logging.L.Error("Error in reading the file", zap.String("file", file), zap.Error(err))
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be read", failed, len(files))
+	}
+
+	return nil
+}
+
+func readStdoutFile(path string, filter storage.Filter, fn func(storage.Log) error) error {
+	if path == "-" {
+		return storage.ReadJSONL(os.Stdin, filter, fn)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	return storage.ReadJSONL(file, filter, fn)
+}
+
+// recordEntry rebuilds the request of a stored difference
+func recordEntry(l storage.Log) capture.Entry {
+	e := capture.Entry{
+		StartedAt:     l.Timestamp,
+		Method:        l.Method,
+		Host:          l.Host,
+		URL:           l.URL,
+		RequestHeader: l.Headers,
+	}
+	if l.RequestBody != nil {
+		e.RequestBody = []byte(*l.RequestBody)
+	}
+
+	return e
+}
+
+// checkRecordBody returns an error when the request body of a stored difference is not the one sent, because it is
+// not stored or redacted. The size of the records stored before it was kept is taken from Content-Length. The
+// captured requests, without a record, are sent as they were.
+func checkRecordBody(l *storage.Log) error {
+	if l == nil {
+		return nil
+	}
+
+	if l.RequestBodyRedacted {
+		return errors.New("the request body is redacted")
+	}
+
+	size := l.RequestBodySize
+	if size == 0 {
+		size, _ = strconv.Atoi(http.Header(l.Headers).Get("Content-Length"))
+	}
+	if l.RequestBody == nil && size > 0 {
+		return errors.New("the request body is not stored, see store_req_body")
+	}
+
+	return nil
+}
+
+// replay replays a request, counts its result and reports it if it is a stored difference
+func (r *replayer) replay(req request) {
+	result, l := resultSkipped, (*storage.Log)(nil)
+	if err := checkRecordBody(req.record); err != nil {
+		logging.L.Warn("Skipping the stored difference, its request can not be rebuilt", zap.String("method", req.entry.Method),
+			zap.String("url", req.entry.URL), zap.String("fingerprint", req.record.Fingerprint), zap.Error(err))
+		metrics.RouteSkipCounter.WithLabelValues("request_body").Inc()
+	} else {
+		result, l = r.compare(req.entry)
+	}
+
+	switch result {
+	case resultIdentical:
+		atomic.AddUint64(&r.summary.replayed, 1)
+		atomic.AddUint64(&r.summary.identical, 1)
+	case resultDifferent:
+		atomic.AddUint64(&r.summary.replayed, 1)
+		atomic.AddUint64(&r.summary.different, 1)
+	case resultSkipped:
+		atomic.AddUint64(&r.summary.skipped, 1)
+	default:
+		atomic.AddUint64(&r.summary.failed, 1)
+	}
+
+	if req.record == nil {
+		return
+	}
+
+	rep := report{
+		Result:                  result,
+		Method:                  req.record.Method,
+		URL:                     req.record.URL,
+		Route:                   req.record.Route,
+		Fingerprint:             req.record.Fingerprint,
+		PreviousComparisonTypes: req.record.ComparisonTypes,
+	}
+	if l != nil {
+		rep.ComparisonTypes = l.ComparisonTypes
+	}
+
+	r.reportMu.Lock()
+	defer r.reportMu.Unlock()
+	if err := r.reports.Encode(rep); err != nil {
+		logging.L.Error("Error in writing the report", zap.Error(err))
+	}
+}
+
+// compare sends a request to the upstreams and runs the comparison pipeline on the responses
+func (r *replayer) compare(e capture.Entry) (result string, l *storage.Log) {
+	route := config.FormatRoute(e.Method, e.Path())
+	loggingFieldsWithError := func(err error) []zap.Field {
+		return []zap.Field{
+			zap.String("method", e.Method),
+			zap.String("url", e.URL),
+			zap.String("route", route),
+			zap.Error(err),
+		}
+	}
+
+	if config.IsRouteSkipped(route) {
+		metrics.RouteSkipCounter.WithLabelValues("config").Inc()
+		return resultSkipped, nil
+	}
+
+	req, err := http.NewRequest(e.Method, e.URL, bytes.NewReader(e.RequestBody))
+	if err != nil {
+		logging.L.Error("error in creating the replayed request", loggingFieldsWithError(err)...)
+		return resultFailed, nil
+	}
+	req.Host = e.Host
+	if e.RequestHeader != nil {
+		req.Header = e.RequestHeader
+	}
+
+	routeConfig := config.GetRequestRouteConfig(route, req)
+	bodyComparison := routeConfig.BodyComparison()
+
+	c := &pipeline.Comparison{
+		Request:     req,
+		RequestBody: e.RequestBody,
+		Route:       route,
+		RouteConfig: routeConfig,
+		Main:        pipeline.NewResponse(e.StatusCode, e.ResponseHeader, e.ResponseBody, e.Duration),
+	}
+
+	if r.mainServiceClient != nil {
+		c.Main, err = send(r.mainServiceClient, config.HTTP.Upstreams.Main.Address, e, bodyComparison, "main_upstream")
+		if err != nil {
+			logging.L.Error("error in replaying the request to the main service", loggingFieldsWithError(err)...)
+			return resultFailed, nil
+		}
+	}
+
+	c.Test, err = send(r.testServiceClient, config.HTTP.Upstreams.Test.Address, e, bodyComparison, "test_upstream")
+	if err != nil {
+		logging.L.Error("error in replaying the request to the test service", loggingFieldsWithError(err)...)
+		return resultFailed, nil
+	}
+
+	if l = pipeline.Compare(c); l == nil {
+		return resultIdentical, nil
+	}
+
+	if r.recorder != nil {
+		r.recorder.Record(c, *l)
+	}
+
+	return resultDifferent, l
+}
+
+// send sends a request to an upstream and reads its response as the body comparison needs it
+func send(client *http.Client, address string, e capture.Entry, bodyComparison, upstreamLabel string) (pipeline.Response, error) {
+	req, err := http.NewRequestWithContext(context.Background(), e.Method, address+e.URL, bytes.NewReader(e.RequestBody))
+	if err != nil {
+		return pipeline.Response{}, err
+	}
+	if e.RequestHeader != nil {
+		req.Header = e.RequestHeader.Clone()
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	t := prometheus.NewTimer(metrics.HTTPReqDuration.WithLabelValues(upstreamLabel))
+	res, err := client.Do(req)
+	duration := t.ObserveDuration()
+	if err != nil {
+		metrics.HTTPReqCounter.WithLabelValues("client_error", upstreamLabel).Inc()
+		return pipeline.Response{}, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	metrics.HTTPReqCounter.WithLabelValues(strconv.Itoa(res.StatusCode), upstreamLabel).Inc()
+
+	response, ok, err := pipeline.ReadResponse(res, duration, bodyComparison, config.HTTP.MaxCaptureSize)
+	if err != nil {
+		return pipeline.Response{}, err
+	}
+	if !ok {
+		metrics.CaptureLimitExceededCounter.WithLabelValues(upstreamLabel).Inc()
+		return pipeline.Response{}, fmt.Errorf("response body exceeds max_capture_size of %d bytes", config.HTTP.MaxCaptureSize)
+	}
+
+	return response, nil
+}